@@ -0,0 +1,224 @@
+package main
+
+import (
+	"strings"
+)
+
+// maxPasswordAttempts is how many wrong passwords a player may enter before
+// being disconnected.
+const maxPasswordAttempts = 3
+
+// echoer is implemented by transports that can stop the player's input from
+// being echoed back to them, e.g. while they type a password.
+type echoer interface {
+	setEcho(on bool)
+}
+
+// readPassword reads a password from the player, hiding it if the player's
+// transport allows.
+func (c *Connection) readPassword() (string, error) {
+	if e, ok := c.Conn.(echoer); ok {
+		e.setEcho(false)
+		defer e.setEcho(true)
+	}
+	return c.readLine()
+}
+
+// validPassword checks that a password is acceptable, returning the reason if
+// it isn't.
+func validPassword(password string) (string, bool) {
+	switch {
+	case len(password) < 4:
+		return "that password is too short. use at least 4 characters.", false
+	case len(password) > 72:
+		return "that password is too long. use at most 72 characters.", false
+	case strings.ContainsAny(password, " \t"):
+		return "passwords can't contain spaces.", false
+	}
+	return "", true
+}
+
+// choosePassword asks the player to pick a new password with the given prompt,
+// and to type it twice to make sure they got it right. It returns false if the
+// player hangs up.
+func (c *Connection) choosePassword(prompt string) (string, bool) {
+	for {
+		c.Emit(promptEvent{Prompt: "new-password", Text: prompt})
+		password, err := c.readPassword()
+		if err != nil {
+			log_error("player failed to choose a password: %v", err)
+			return "", false
+		}
+		if reason, ok := validPassword(password); !ok {
+			c.Printf("%s\n", reason)
+			continue
+		}
+		c.Emit(promptEvent{Prompt: "confirm-password", Text: "Type it again to confirm:"})
+		confirm, err := c.readPassword()
+		if err != nil {
+			log_error("player failed to confirm their password: %v", err)
+			return "", false
+		}
+		if confirm != password {
+			c.Printf("those passwords don't match.\n")
+			continue
+		}
+		return password, true
+	}
+}
+
+// checkPassword asks the player for their profile's password. It returns false
+// if the player doesn't get it right within maxPasswordAttempts.
+func (c *Connection) checkPassword(p *Profile) bool {
+	for i := 0; i < maxPasswordAttempts; i++ {
+		c.Emit(promptEvent{Prompt: "password", Text: "Password:"})
+		password, err := c.readPassword()
+		if err != nil {
+			log_error("player failed to enter a password: %v", err)
+			return false
+		}
+		if p.CheckPassword(password) {
+			return true
+		}
+		c.Printf("wrong password.\n")
+	}
+	log_info("too many failed login attempts for %s from %v", p.name, c.RemoteAddr())
+	c.Printf("too many failed attempts.\n")
+	return false
+}
+
+// confirmPassword asks the player to type their password again before a change
+// is made to their account. It returns false if they get it wrong.
+func (c *Connection) confirmPassword() bool {
+	c.Emit(promptEvent{Prompt: "password", Text: "Password:"})
+	password, err := c.readPassword()
+	if err != nil {
+		log_error("player failed to confirm their password: %v", err)
+		return false
+	}
+	if !c.profile.CheckPassword(password) {
+		c.Printf("wrong password.\n")
+		return false
+	}
+	return true
+}
+
+// seatedIn finds a running game in which the player still has a seat. An
+// account can't be renamed or deleted while it has a seat, since seats are
+// reclaimed by name.
+func seatedIn(name string) *Game {
+	for _, game := range gm.List() {
+		for _, player := range game.PlayerNames() {
+			if player == name {
+				return game
+			}
+		}
+	}
+	return nil
+}
+
+var passwdCommand = Command{
+	name:     "passwd",
+	summary:  "changes your password",
+	usage:    "passwd",
+	arity:    0,
+	variadic: false,
+	help: `
+Asks for your current password, then for the one you'd like instead. Neither
+is shown as you type it.
+`,
+	handler: func(c *Connection, args ...string) {
+		if len(args) != 0 {
+			c.Printf("Usage: passwd\n")
+			return
+		}
+		if c.profile.password != nil && !c.confirmPassword() {
+			return
+		}
+		password, ok := c.choosePassword("Choose a password:")
+		if !ok {
+			return
+		}
+		if err := c.profile.SetPassword(password); err != nil {
+			log_error("unable to change password for %s: %v", c.profile.name, err)
+			c.Printf("unable to change your password.\n")
+			return
+		}
+		c.Printf("your password has been changed.\n")
+	},
+}
+
+var renameCommand = Command{
+	name:     "rename",
+	summary:  "changes your name",
+	usage:    "rename [new-name]",
+	arity:    1,
+	variadic: false,
+	help: `
+Changes the name you play under. You'll be asked for your password first.
+`,
+	handler: func(c *Connection, args ...string) {
+		if len(args) != 1 {
+			c.Printf("Usage: rename [new-name]\n")
+			return
+		}
+		name := args[0]
+		if !c.confirmPassword() {
+			return
+		}
+		if !ValidName(name) {
+			c.Printf("that name is illegal.\n")
+			return
+		}
+		if _, err := loadProfile(name); err == nil {
+			c.Printf("the name %s is already taken.\n", name)
+			return
+		}
+		if game := seatedIn(c.profile.name); game != nil {
+			c.Printf("you can't change your name while you have a seat in game %s.\n", game.id)
+			return
+		}
+		old := c.profile.name
+		if err := c.profile.Rename(name); err != nil {
+			log_error("unable to rename %s to %s: %v", old, name, err)
+			c.Printf("unable to change your name.\n")
+			return
+		}
+		log_info("player %s renamed to %s", old, name)
+		c.Printf("you are now known as %s.\n", name)
+	},
+}
+
+var deleteAccountCommand = Command{
+	name:     "delete",
+	summary:  "deletes your account",
+	usage:    "delete",
+	arity:    0,
+	variadic: false,
+	help: `
+Permanently deletes your account, along with any ssh keys you've registered.
+Your name becomes available for anyone to take, and you are disconnected.
+You'll be asked for your password first.
+`,
+	handler: func(c *Connection, args ...string) {
+		if len(args) != 0 {
+			c.Printf("Usage: delete\n")
+			return
+		}
+		if !c.confirmPassword() {
+			return
+		}
+		if game := seatedIn(c.profile.name); game != nil {
+			c.Printf("you can't delete your account while you have a seat in game %s.\n", game.id)
+			return
+		}
+		if err := c.profile.Delete(); err != nil {
+			log_error("unable to delete profile %s: %v", c.profile.name, err)
+			c.Printf("unable to delete your account.\n")
+			return
+		}
+		log_info("player %s deleted their account", c.profile.name)
+		c.Printf("your account has been deleted. farewell, %s.\n", c.profile.name)
+		c.Close()
+	},
+}
@@ -10,22 +10,23 @@ type Bomb struct {
 	profile *Connection
 	origin  *System
 	target  *System
-	start   time.Time
+	start   int64 // frame on which the bomb was launched
 	done    bool
 	fti     int64 // frames to impact
 }
 
 func NewBomb(conn *Connection, from, to *System) *Bomb {
 	dist := from.DistanceTo(to)
-	fti := int64(dist / (options.lightSpeed * options.bombSpeed))
-	eta := time.Duration(fti) * time.Second / time.Duration(options.frameRate)
+	rules := conn.game.rules
+	fti := int64(dist / (rules.LightSpeed * rules.BombSpeed))
+	eta := rules.duration(fti)
 	log_info("bomb from: %v to: %v ETA: %v", from, to, eta)
 	return &Bomb{
 		profile: conn,
 		origin:  from,
 		target:  to,
 		fti:     fti,
-		start:   time.Now(),
+		start:   conn.game.frame,
 	}
 }
 
@@ -43,7 +44,7 @@ func (b *Bomb) Tick(game *Game) {
 }
 
 func (b *Bomb) String() string {
-	return fmt.Sprintf("[bomb from: %v to: %v lived: %s]", b.origin, b.target, time.Since(b.start))
+	return fmt.Sprintf("[bomb from: %v to: %v launched: %d]", b.origin, b.target, b.start)
 }
 
 type MakeBombState struct {
@@ -56,6 +57,7 @@ func MakeBomb(s *System) ConnectionState {
 	m := &MakeBombState{System: s}
 	m.CommandSuite = CommandSet{
 		balCommand,
+		intelCommand,
 		BroadcastCommand(s),
 		NearbyCommand(s),
 		playersCommand,
@@ -65,14 +67,14 @@ func MakeBomb(s *System) ConnectionState {
 
 func (m *MakeBombState) Enter(c *Connection) {
 	c.Printf("Making a bomb...\n")
-	c.money -= options.bombCost
+	c.money -= c.game.rules.BombCost
 }
 
 func (m *MakeBombState) Tick(c *Connection, frame int64) ConnectionState {
 	if m.start == 0 {
 		m.start = frame
 	}
-	if framesToDur(frame-m.start) >= options.makeBombTime {
+	if c.game.rules.duration(frame-m.start) >= time.Duration(c.game.rules.MakeBombTime) {
 		return Idle(m.System)
 	}
 	return m
@@ -87,14 +89,14 @@ func (m *MakeBombState) Exit(c *Connection) {
 
 func (m *MakeBombState) FillStatus(c *Connection, s *status) {
 	elapsedFrames := c.game.frame - m.start
-	elapsedDur := framesToDur(elapsedFrames)
+	elapsedDur := c.game.rules.duration(elapsedFrames)
 
 	desc := fmt.Sprintf(`
 Currently making a bomb!
 
 Build time elapsed:   %v
 Build time remaining: %v
-`, elapsedDur, options.makeBombTime-elapsedDur)
+`, elapsedDur, time.Duration(c.game.rules.MakeBombTime)-elapsedDur)
 	s.Description = strings.TrimSpace(desc)
 	s.Location = m.System.String()
 }
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestBombKill(t *testing.T) {
+	h := newHarness(t)
+	alice := h.Join("alice", 1)
+	bob := h.Join("bob", 2)
+	alice.conn.bombs = 1
+
+	alice.Send("bomb 2")
+	h.Step(1)
+	if alice.conn.bombs != 0 {
+		t.Fatalf("expected alice to have used her bomb, she has %d", alice.conn.bombs)
+	}
+
+	// a bomb travels a parsec in 1/(c*bombSpeed) frames
+	frames := int(1 / (h.game.rules.LightSpeed * h.game.rules.BombSpeed))
+	h.Step(frames + 1)
+	if _, ok := bob.conn.ConnectionState.(*DeadState); !ok {
+		t.Fatalf("expected bob to be dead, he is %v", bob.conn.ConnectionState)
+	}
+	if alice.conn.kills != 1 {
+		t.Fatalf("expected alice to have 1 kill, she has %d", alice.conn.kills)
+	}
+	if h.System(2).players[bob.conn] {
+		t.Fatalf("bob's corpse is still on Beta")
+	}
+
+	// news of the bombing reaches alice at the speed of light.
+	h.Step(int(1/h.game.rules.LightSpeed) + 1)
+	alice.Expect("a bombing has been observed on Beta")
+}
+
+func TestBombStoppedByShield(t *testing.T) {
+	h := newHarness(t)
+	alice := h.Join("alice", 1)
+	bob := h.Join("bob", 2)
+	alice.conn.bombs = 1
+	h.System(2).Shield = &Shield{energy: 1000}
+
+	alice.Send("bomb Beta")
+	h.Step(int(1/(h.game.rules.LightSpeed*h.game.rules.BombSpeed)) + 2)
+
+	bob.Expect("stopped by the system's shield")
+	if _, ok := bob.conn.ConnectionState.(*IdleState); !ok {
+		t.Fatalf("expected bob to have survived, he is %v", bob.conn.ConnectionState)
+	}
+	if alice.conn.kills != 0 {
+		t.Fatalf("expected alice to have no kills, she has %d", alice.conn.kills)
+	}
+}
+
+func TestBombWithoutBombs(t *testing.T) {
+	h := newHarness(t)
+	alice := h.Join("alice", 1)
+	alice.conn.bombs = 0
+
+	alice.Send("bomb 2")
+	h.Step(1)
+	alice.Expect("no bombs left")
+}
@@ -1,48 +1,17 @@
 package main
 
-import (
-	"fmt"
-	"time"
-)
-
-type broadcast struct {
-	start        time.Time
-	origin       *System
-	dist         float64
-	message      string
-	neighborhood Neighborhood
-}
-
-func NewBroadcast(from *System, template string, args ...interface{}) *broadcast {
-	return &broadcast{
-		start:   time.Now(),
-		origin:  from,
-		message: fmt.Sprintf(template, args...),
-	}
+// broadcastEvent is a message that a player has broadcast from a system for
+// all of the galaxy to hear.
+type broadcastEvent struct {
+	message string
 }
 
-func (b *broadcast) Tick(game *Game) {
-	if b.neighborhood == nil {
-		log_info("setting up neighborhood for broadcast: %s", b.message)
-		b.neighborhood = game.galaxy.Neighborhood(b.origin)
-		log_info("nearest neighbor: %v", b.neighborhood[0])
-	}
-
-	b.dist += options.lightSpeed
-	for len(b.neighborhood) > 0 && b.neighborhood[0].distance <= b.dist {
-		s := game.galaxy.GetSystemByID(b.neighborhood[0].id)
-		log_info("broadcast %s has reached %s from %s", b.message, s, b.origin)
-		s.NotifyInhabitants("message received from system %v:\n\t%s\n", b.origin, b.message)
-		if len(b.neighborhood) > 1 {
-			b.neighborhood = b.neighborhood[1:]
-		} else {
-			b.neighborhood = nil
-		}
-	}
-}
-
-func (b *broadcast) Dead() bool { return b.neighborhood == nil }
-
-func (b *broadcast) String() string {
-	return fmt.Sprintf("[broadcast origin: %v message: %s]", b.origin, b.message)
+func (e broadcastEvent) Observe(g *Game, from, at *System, sent int64) {
+	learn(at, from, sent, func(r *intelReport) {
+		r.lastMessage = e.message
+	})
+	log_info("broadcast %s has reached %s from %s", e.message, at, from)
+	at.EachConn(func(conn *Connection) {
+		conn.Emit(broadcastMessageEvent{From: *from.ref(), Message: e.message})
+	})
 }
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// catalogFormat reads the star systems out of a catalog file. A problem with
+// any one system is reported along with the line it's on, and reading goes
+// on so that every problem in the file can be fixed at once.
+type catalogFormat interface {
+	readCatalog(r io.Reader) ([]System, error)
+}
+
+// catalogFormats are the formats a catalog may be written in, by name. A
+// catalog whose format isn't given is assumed to be in the format named by
+// its file extension.
+var catalogFormats = map[string]catalogFormat{
+	"speck": speckFormat{},
+	"csv":   csvFormat{},
+	"json":  jsonFormat{},
+}
+
+// maxCatalogErrors is how many problems are reported before a catalog is
+// given up on.
+const maxCatalogErrors = 20
+
+// readCatalog reads the catalog file at the given path. Systems are numbered
+// from 1 in the order in which they appear, and then cleaned up, which may
+// leave gaps in the numbering.
+func readCatalog(path, format string) ([]System, error) {
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(path), ".")
+	}
+	f, ok := catalogFormats[strings.ToLower(format)]
+	if !ok {
+		return nil, fmt.Errorf("unknown format for catalog %s: %q. formats are speck, csv and json", path, format)
+	}
+	fi, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open catalog: %v", err)
+	}
+	defer fi.Close()
+
+	systems, err := f.readCatalog(fi)
+	if err != nil {
+		return nil, fmt.Errorf("bad catalog %s:\n%v", path, err)
+	}
+	if len(systems) == 0 {
+		return nil, fmt.Errorf("catalog %s has no systems in it", path)
+	}
+	for i := range systems {
+		systems[i].id = i + 1
+	}
+	cleaned, report := cleanCatalog(systems)
+	for _, line := range report {
+		log_info("catalog %s: %s", path, line)
+	}
+	log_info("catalog %s: read %d systems, kept %d", path, len(systems), len(cleaned))
+	return cleaned, nil
+}
+
+// catalogs holds the catalogs that rule sets build their galaxies from, so
+// that each file is only read once.
+var catalogs = struct {
+	sync.Mutex
+	loaded map[string][]System
+}{loaded: make(map[string][]System)}
+
+// loadCatalog gives a fresh copy of the systems in a catalog file, reading the
+// file the first time it's asked for.
+func loadCatalog(path, format string) ([]*System, error) {
+	catalogs.Lock()
+	defer catalogs.Unlock()
+
+	key := format + ":" + path
+	systems, ok := catalogs.loaded[key]
+	if !ok {
+		var err error
+		if systems, err = readCatalog(path, format); err != nil {
+			return nil, err
+		}
+		catalogs.loaded[key] = systems
+	}
+	fresh := make([]*System, len(systems))
+	for i := range systems {
+		s := systems[i]
+		fresh[i] = &s
+	}
+	return fresh, nil
+}
+
+// checkSystem reports what's wrong with a system read from a catalog, if
+// anything.
+func checkSystem(s System) error {
+	for _, v := range []float64{s.x, s.y, s.z} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("position of %q is not a finite number", s.name)
+		}
+	}
+	switch {
+	case s.name == "":
+		return fmt.Errorf("system has no name")
+	case s.planets < 0:
+		return fmt.Errorf("%q has a negative number of planets", s.name)
+	}
+	return nil
+}
+
+// catalogErrors collects the problems found in a catalog.
+type catalogErrors struct {
+	errorGroup
+}
+
+func (c *catalogErrors) add(line int, err error) {
+	if err != nil {
+		c.AddError(fmt.Errorf("line %d: %v", line, err))
+	}
+}
+
+// full checks whether enough problems have been found to give up on reading
+// the rest of the catalog.
+func (c *catalogErrors) full() bool { return len(c.errorGroup) >= maxCatalogErrors }
+
+func (c *catalogErrors) err() error {
+	if len(c.errorGroup) == 0 {
+		return nil
+	}
+	if c.full() {
+		c.AddError(fmt.Errorf("giving up after %d problems", len(c.errorGroup)))
+	}
+	return c.errorGroup
+}
+
+// csvFormat reads catalogs of comma-separated values with a header row naming
+// the columns, as in the HYG database. x, y and z give a system's position in
+// parsecs and name, or HYG's proper, its name. planets is the number of
+// planets, 1 if there's no such column. Other columns are ignored.
+type csvFormat struct{}
+
+func (csvFormat) readCatalog(r io.Reader) ([]System, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read header: %v", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["name"]; !ok {
+		if col, ok := columns["proper"]; ok {
+			columns["name"] = col
+		}
+	}
+	for _, name := range []string{"x", "y", "z", "name"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("line 1: header has no %s column", name)
+		}
+	}
+
+	var (
+		systems []System
+		errs    catalogErrors
+	)
+	for !errs.full() {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		line, _ := cr.FieldPos(0)
+		if err != nil {
+			if pe, ok := err.(*csv.ParseError); ok {
+				line, err = pe.Line, pe.Err
+			}
+			errs.add(line, err)
+			break
+		}
+		if len(record) != len(header) {
+			errs.add(line, fmt.Errorf("expected %d columns, found %d", len(header), len(record)))
+			continue
+		}
+		s, err := parseCSVRecord(record, columns)
+		if err == nil {
+			err = checkSystem(s)
+		}
+		errs.add(line, err)
+		systems = append(systems, s)
+	}
+	return systems, errs.err()
+}
+
+func parseCSVRecord(record []string, columns map[string]int) (System, error) {
+	s := System{name: strings.TrimSpace(record[columns["name"]]), planets: 1}
+	var err error
+	for _, c := range []struct {
+		name string
+		v    *float64
+	}{{"x", &s.x}, {"y", &s.y}, {"z", &s.z}} {
+		field := strings.TrimSpace(record[columns[c.name]])
+		if *c.v, err = strconv.ParseFloat(field, 64); err != nil {
+			return s, fmt.Errorf("bad %s coordinate %q", c.name, field)
+		}
+	}
+	if col, ok := columns["planets"]; ok {
+		field := strings.TrimSpace(record[col])
+		if s.planets, err = strconv.Atoi(field); err != nil {
+			return s, fmt.Errorf("bad number of planets %q", field)
+		}
+	}
+	return s, nil
+}
+
+// jsonFormat reads catalogs written as a JSON array of systems, e.g.:
+//
+//	[
+//	    {"name": "Sol", "x": 0, "y": 0, "z": 0, "planets": 8},
+//	    {"name": "Proxima Centauri", "x": -0.47, "y": -0.36, "z": -1.16}
+//	]
+//
+// Positions are in parsecs. planets defaults to 1.
+type jsonFormat struct{}
+
+type jsonSystem struct {
+	Name    string   `json:"name"`
+	X       *float64 `json:"x"`
+	Y       *float64 `json:"y"`
+	Z       *float64 `json:"z"`
+	Planets *int     `json:"planets"`
+}
+
+func (jsonFormat) readCatalog(r io.Reader) ([]System, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read catalog: %v", err)
+	}
+	// lineAt finds the line of the value that starts at or after the offset
+	lineAt := func(offset int64) int {
+		for offset < int64(len(b)) && strings.ContainsRune(" \t\r\n,", rune(b[offset])) {
+			offset++
+		}
+		return 1 + bytes.Count(b[:offset], []byte("\n"))
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if t, err := dec.Token(); err != nil || t != json.Delim('[') {
+		return nil, fmt.Errorf("line %d: expected an array of systems", lineAt(0))
+	}
+	var (
+		systems []System
+		errs    catalogErrors
+	)
+	for dec.More() && !errs.full() {
+		line := lineAt(dec.InputOffset())
+		var js jsonSystem
+		if err := dec.Decode(&js); err != nil {
+			errs.add(line, err)
+			if _, ok := err.(*json.SyntaxError); ok {
+				// there's no telling where the next system starts
+				break
+			}
+			continue
+		}
+		s := System{name: strings.TrimSpace(js.Name), planets: 1}
+		if js.X == nil || js.Y == nil || js.Z == nil {
+			errs.add(line, fmt.Errorf("%q is missing a coordinate", s.name))
+			continue
+		}
+		s.x, s.y, s.z = *js.X, *js.Y, *js.Z
+		if js.Planets != nil {
+			s.planets = *js.Planets
+		}
+		errs.add(line, checkSystem(s))
+		systems = append(systems, s)
+	}
+	return systems, errs.err()
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeCatalog(t *testing.T, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("unable to write catalog: %v", err)
+	}
+	return path
+}
+
+// expectLineErrors checks that a catalog was rejected for problems on exactly
+// the given lines.
+func expectLineErrors(t *testing.T, err error, lines ...string) {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("expected the catalog to be rejected")
+	}
+	msg := err.Error()
+	for _, line := range lines {
+		if !strings.Contains(msg, "line "+line+":") {
+			t.Errorf("expected a problem on line %s, got:\n%s", line, msg)
+		}
+	}
+	if n := strings.Count(msg, "line "); n != len(lines) {
+		t.Errorf("expected %d problems, got %d:\n%s", len(lines), n, msg)
+	}
+}
+
+func TestSpeckCatalog(t *testing.T) {
+	systems, err := readCatalog("./expl.speck", "")
+	if err != nil {
+		t.Fatalf("unable to read expl.speck: %v", err)
+	}
+	// two pairs of the 551 systems in expl.speck are merged
+	if len(systems) != 549 {
+		t.Fatalf("expected 549 systems in expl.speck, got %d", len(systems))
+	}
+	first := systems[0]
+	if first.id != 1 || first.name != "11 Com" || first.x != -2.2931 || first.planets != 1 {
+		t.Fatalf("first system was read wrong: %+v", first)
+	}
+
+	path := writeCatalog(t, "bad.speck", `datavar 0 numplanets
+datavar 1 distance
+1 2 3 1 12.2 1 # Fine
+1 2 x 1 12.2 1 # Bad Z
+1 2 3 1 # Short
+1 2 3 1 500 1 # Far Off
+1 2 3 1 12.2 1
+`)
+	_, err = readCatalog(path, "")
+	expectLineErrors(t, err, "4", "5", "6", "7")
+}
+
+func TestCSVCatalog(t *testing.T) {
+	path := writeCatalog(t, "stars.csv", `id,proper,x,y,z,mag
+0,Sol,0,0,0,-26.7
+1,Proxima Centauri,-0.47,-0.36,-1.16,11.1
+`)
+	systems, err := readCatalog(path, "")
+	if err != nil {
+		t.Fatalf("unable to read csv catalog: %v", err)
+	}
+	if len(systems) != 2 || systems[1].name != "Proxima Centauri" || systems[1].z != -1.16 || systems[1].planets != 1 {
+		t.Fatalf("csv catalog was read wrong: %+v", systems)
+	}
+
+	path = writeCatalog(t, "bad.txt", `name,x,y,z,planets
+Fine,1,2,3,1
+,1,2,3,1
+Bad X,one,2,3,1
+Short,1,2
+Negative,1,2,3,-1
+`)
+	_, err = readCatalog(path, "csv")
+	expectLineErrors(t, err, "3", "4", "5", "6")
+
+	if _, err := readCatalog(writeCatalog(t, "nox.csv", "name,y,z\nA,1,2\n"), ""); err == nil || !strings.Contains(err.Error(), "no x column") {
+		t.Fatalf("expected a catalog without an x column to be rejected, got %v", err)
+	}
+}
+
+func TestJSONCatalog(t *testing.T) {
+	path := writeCatalog(t, "stars.json", `[
+	{"name": "Sol", "x": 0, "y": 0, "z": 0, "planets": 8},
+	{"name": "Proxima Centauri", "x": -0.47, "y": -0.36, "z": -1.16}
+]`)
+	systems, err := readCatalog(path, "")
+	if err != nil {
+		t.Fatalf("unable to read json catalog: %v", err)
+	}
+	if len(systems) != 2 || systems[0].planets != 8 || systems[1].planets != 1 || systems[1].id != 2 {
+		t.Fatalf("json catalog was read wrong: %+v", systems)
+	}
+
+	path = writeCatalog(t, "bad.json", `[
+	{"name": "Fine", "x": 0, "y": 0, "z": 0},
+	{"name": "No Z", "x": 0, "y": 0},
+	{"name": "Bad X", "x": "zero", "y": 0, "z": 0},
+	{"name": "Typo", "x": 0, "y": 0, "z": 0, "planet": 2},
+	{"x": 0, "y": 0, "z": 0}
+]`)
+	_, err = readCatalog(path, "")
+	expectLineErrors(t, err, "3", "4", "5", "6")
+}
+
+func TestCatalogErrorLimit(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("name,x,y,z\n")
+	for i := 0; i < 100; i++ {
+		b.WriteString("Bad,x,0,0\n")
+	}
+	_, err := readCatalog(writeCatalog(t, "awful.csv", b.String()), "")
+	if err == nil || !strings.Contains(err.Error(), "giving up after 20 problems") {
+		t.Fatalf("expected reading to stop after %d problems, got %v", maxCatalogErrors, err)
+	}
+}
+
+func TestRulesCatalog(t *testing.T) {
+	path := writeCatalog(t, "tiny.json", `[
+	{"name": "Here", "x": 0, "y": 0, "z": 0},
+	{"name": "There", "x": 30, "y": 0, "z": 0},
+	{"name": "Everywhere", "x": 0, "y": 30, "z": 0}
+]`)
+	rules := defaultRules()
+	rules.Catalog = path
+	g := NewGalaxy(rand.New(rand.NewSource(1)), rules)
+	if len(g.Systems()) != 3 || g.GetSystemByName("Everywhere") == nil {
+		t.Fatalf("expected a galaxy built from the rules' catalog, got %v", g.Systems())
+	}
+
+	// every galaxy gets systems of its own
+	g.GetSystemByName("Here").money = -1
+	g = NewGalaxy(rand.New(rand.NewSource(1)), rules)
+	if g.GetSystemByName("Here").money == -1 {
+		t.Fatalf("galaxies built from the same catalog share systems")
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// mergeDistance is how close, in parsecs, two systems in a catalog have to be
+// to be taken for the same system. Catalogs often list a star once for each
+// of its names, or once for each of its components.
+const mergeDistance = 0.01
+
+// componentName matches the name of one star of a multiple system, e.g.
+// "HD 41004 B".
+var componentName = regexp.MustCompile(`^(.*\S)\s+([A-Z][a-z]?)$`)
+
+// cleanCatalog tidies up the systems read from a catalog. Names have stray
+// whitespace and unprintable characters taken out. Systems at the same
+// position are merged into the one that comes first: copies of the same
+// system keep the most planets any copy gives, the components of a multiple
+// system, e.g. "HD 41004 A" and "HD 41004 B", become a single "HD 41004 AB"
+// with the planets of both, and anything else is taken for another name of
+// the same star. Systems that are apart but share a name are told apart by a
+// number. Every change is described in the report.
+func cleanCatalog(systems []System) (cleaned []System, report []string) {
+	for i := range systems {
+		if name := tidyName(systems[i].name); name != systems[i].name {
+			report = append(report, fmt.Sprintf("renamed %q (id %d) to %q", systems[i].name, systems[i].id, name))
+			systems[i].name = name
+		}
+	}
+
+	// group systems that are close enough together to be the same one
+	parent := make([]int, len(systems))
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	ptrs := make([]*System, len(systems))
+	index := make(map[*System]int, len(systems))
+	for i := range systems {
+		parent[i] = i
+		ptrs[i] = &systems[i]
+		index[ptrs[i]] = i
+	}
+	tree := newKDTree(ptrs)
+	for i, sys := range ptrs {
+		tree.eachWithin(sys, mergeDistance, func(other *System, _ float64) {
+			a, b := find(i), find(index[other])
+			if a > b {
+				a, b = b, a
+			}
+			parent[b] = a
+		})
+	}
+	groups := make(map[int][]System)
+	var order []int
+	for i := range systems {
+		root := find(i)
+		if groups[root] == nil {
+			order = append(order, root)
+		}
+		groups[root] = append(groups[root], systems[i])
+	}
+
+	taken := make(map[string]bool, len(order))
+	for _, root := range order {
+		sys, note := mergeSystems(groups[root])
+		if note != "" {
+			report = append(report, note)
+		}
+		if taken[nameKey(sys.name)] {
+			name := sys.name
+			for n := 2; taken[nameKey(sys.name)]; n++ {
+				sys.name = fmt.Sprintf("%s %d", name, n)
+			}
+			report = append(report, fmt.Sprintf("renamed %s (id %d) to %s, since another system has the same name", name, sys.id, sys.name))
+		}
+		taken[nameKey(sys.name)] = true
+		cleaned = append(cleaned, sys)
+	}
+	return cleaned, report
+}
+
+// mergeSystems merges systems at the same position into the first of them,
+// describing what it did.
+func mergeSystems(group []System) (System, string) {
+	merged := group[0]
+	if len(group) == 1 {
+		return merged, ""
+	}
+	describe := func(systems []System) string {
+		parts := make([]string, len(systems))
+		for i, s := range systems {
+			parts[i] = fmt.Sprintf("%s (id %d)", s.name, s.id)
+		}
+		return strings.Join(parts, ", ")
+	}
+
+	// copies of the same system are counted once, with the most planets any
+	// of them gives
+	var distinct []System
+	seen := make(map[string]int)
+	for _, s := range group {
+		if i, ok := seen[nameKey(s.name)]; ok {
+			if s.planets > distinct[i].planets {
+				distinct[i].planets = s.planets
+			}
+			continue
+		}
+		seen[nameKey(s.name)] = len(distinct)
+		distinct = append(distinct, s)
+	}
+	if len(distinct) == 1 {
+		merged.planets = distinct[0].planets
+		return merged, fmt.Sprintf("merged copies of the same system: %s, into %s with %s", describe(group), merged.name, planetCount(merged.planets))
+	}
+
+	// the components of a multiple system bring their own planets
+	if prefix, suffixes, ok := components(distinct); ok {
+		merged.name = prefix + " " + strings.Join(suffixes, "")
+		merged.planets = 0
+		for _, s := range distinct {
+			merged.planets += s.planets
+		}
+		return merged, fmt.Sprintf("merged the components of a multiple system: %s, into %s with %s", describe(group), merged.name, planetCount(merged.planets))
+	}
+
+	// otherwise they're one star with many names, and its planets are listed
+	// under each of them
+	for _, s := range distinct {
+		if s.planets > merged.planets {
+			merged.planets = s.planets
+		}
+	}
+	return merged, fmt.Sprintf("merged systems at the same position: %s, into %s with %s", describe(group), merged.name, planetCount(merged.planets))
+}
+
+// components checks whether the systems are the stars of a multiple system,
+// giving the name they share and the letters they're told apart by.
+func components(systems []System) (prefix string, suffixes []string, ok bool) {
+	for i, s := range systems {
+		m := componentName.FindStringSubmatch(s.name)
+		if m == nil || i > 0 && nameKey(m[1]) != nameKey(prefix) {
+			return "", nil, false
+		}
+		prefix = m[1]
+		suffixes = append(suffixes, m[2])
+	}
+	sort.Strings(suffixes)
+	return prefix, suffixes, true
+}
+
+func planetCount(n int) string {
+	if n == 1 {
+		return "1 planet"
+	}
+	return fmt.Sprintf("%d planets", n)
+}
+
+// tidyName takes unprintable characters and stray whitespace out of a name.
+func tidyName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return ' '
+		}
+		if !unicode.IsPrint(r) {
+			return -1
+		}
+		return r
+	}, name)
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// nameKey is the form of a name that's used to look it up, so that players
+// needn't get its capitalization or spacing exactly right.
+func nameKey(name string) string {
+	return strings.ToLower(tidyName(name))
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCleanCatalog(t *testing.T) {
+	systems := []System{
+		{id: 1, name: "  81   Cet ", x: 1, y: 2, z: 3, planets: 1},
+		{id: 2, name: "81 Cet", x: 1, y: 2, z: 3, planets: 2},
+		{id: 3, name: "HD 41004 B", x: 5, y: 5, z: 5, planets: 1},
+		{id: 4, name: "HD 41004 A", x: 5, y: 5, z: 5, planets: 1},
+		{id: 5, name: "Gl 785", x: 7.4038, y: 2.0705, z: -4.3309, planets: 3},
+		{id: 6, name: "HD 192310", x: 7.4004, y: 2.0696, z: -4.3293, planets: 2},
+		{id: 7, name: "Twin", x: 10, y: 0, z: 0, planets: 1},
+		{id: 8, name: "twin", x: 20, y: 0, z: 0, planets: 1},
+	}
+	cleaned, report := cleanCatalog(systems)
+
+	want := []System{
+		{id: 1, name: "81 Cet", planets: 2},
+		{id: 3, name: "HD 41004 AB", planets: 2},
+		{id: 5, name: "Gl 785", planets: 3},
+		{id: 7, name: "Twin", planets: 1},
+		{id: 8, name: "twin 2", planets: 1},
+	}
+	if len(cleaned) != len(want) {
+		t.Fatalf("expected %d systems after cleaning, got %d: %v", len(want), len(cleaned), cleaned)
+	}
+	for i, w := range want {
+		if got := cleaned[i]; got.id != w.id || got.name != w.name || got.planets != w.planets {
+			t.Errorf("expected %s (id %d) with %d planets, got %s (id %d) with %d planets", w.name, w.id, w.planets, got.name, got.id, got.planets)
+		}
+	}
+
+	all := strings.Join(report, "\n")
+	for _, s := range []string{
+		`renamed "  81   Cet " (id 1) to "81 Cet"`,
+		"merged copies of the same system",
+		"merged the components of a multiple system",
+		"merged systems at the same position: Gl 785 (id 5), HD 192310 (id 6)",
+		"renamed twin (id 8) to twin 2",
+	} {
+		if !strings.Contains(all, s) {
+			t.Errorf("expected the report to say %q, got:\n%s", s, all)
+		}
+	}
+
+	if again, report := cleanCatalog(cleaned); len(again) != len(cleaned) || len(report) != 0 {
+		t.Fatalf("cleaning a clean catalog changed it: %v", report)
+	}
+}
+
+func TestGalaxyNameLookup(t *testing.T) {
+	g := testGalaxy(defaultTestGalaxy())
+	for _, name := range []string{"Alpha", "alpha", " ALPHA  "} {
+		if sys := g.GetSystemByName(name); sys == nil || sys.name != "Alpha" {
+			t.Errorf("expected %q to find Alpha, got %v", name, sys)
+		}
+	}
+}
+
+func TestCleanPlanets(t *testing.T) {
+	if _, err := db.Exec(`insert into planets (id, name, x, y, z, planets) values (9001, 'Dupe', 900, 900, 900, 1), (9002, 'Dupe', 900, 900, 900, 4)`); err != nil {
+		t.Fatalf("unable to add duplicate planets: %v", err)
+	}
+	t.Cleanup(func() { db.Exec(`delete from planets where id > 9000`) })
+
+	cleanPlanets()
+	var n, planets int
+	if err := db.QueryRow(`select count(*), max(planets) from planets where name = 'Dupe'`).Scan(&n, &planets); err != nil {
+		t.Fatalf("unable to count planets: %v", err)
+	}
+	if n != 1 || planets != 4 {
+		t.Fatalf("expected the duplicates to be merged into one system with 4 planets, got %d systems with up to %d", n, planets)
+	}
+}
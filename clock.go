@@ -0,0 +1,45 @@
+package main
+
+import (
+	"time"
+)
+
+// Clock is the source of time for a game. Games normally run against the wall
+// clock, but a game can be given a manual clock so that it can be simulated
+// faster than real time.
+type Clock interface {
+	// Now is the current time, according to the clock.
+	Now() time.Time
+
+	// Ticker returns a channel that delivers the time every d, along with a
+	// function that stops the ticker.
+	Ticker(d time.Duration) (<-chan time.Time, func())
+}
+
+// wallClock is a Clock that reads the system's real time.
+type wallClock struct{}
+
+func (wallClock) Now() time.Time { return time.Now() }
+
+func (wallClock) Ticker(d time.Duration) (<-chan time.Time, func()) {
+	t := time.NewTicker(d)
+	return t.C, t.Stop
+}
+
+// manualClock is a Clock that only moves when it is advanced. Its ticker
+// never fires: a game with a manual clock is driven by calling Game.Step.
+type manualClock struct {
+	now time.Time
+}
+
+func newManualClock(start time.Time) *manualClock {
+	return &manualClock{now: start}
+}
+
+func (c *manualClock) Now() time.Time { return c.now }
+
+func (c *manualClock) Ticker(d time.Duration) (<-chan time.Time, func()) {
+	return nil, func() {}
+}
+
+func (c *manualClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
@@ -1,27 +1,33 @@
 package main
 
-import ()
+import (
+	"time"
+)
 
 func MakeColony(c *Connection, sys *System) {
-	if c.money < options.colonyCost {
-		c.Printf("Not enough money!  Colonies cost %v but you only have %v space duckets.  Mine more space duckets!\n", options.colonyCost, c.money)
+	if c.money < c.game.rules.ColonyCost {
+		c.Printf("Not enough money!  Colonies cost %v but you only have %v space duckets.  Mine more space duckets!\n", c.game.rules.ColonyCost, c.money)
 		return
 	}
 	if sys.colonizedBy == c {
 		c.Printf("You've already colonized this system.\n")
 		return
 	}
-	c.money -= options.colonyCost
-	m := &MakeColonyState{
+	c.money -= c.game.rules.ColonyCost
+	c.SetState(newMakeColonyState(sys))
+}
+
+func newMakeColonyState(sys *System) *MakeColonyState {
+	return &MakeColonyState{
 		System: sys,
 		CommandSuite: CommandSet{
 			balCommand,
+			intelCommand,
 			BroadcastCommand(sys),
 			NearbyCommand(sys),
 			playersCommand,
 		},
 	}
-	c.SetState(m)
 }
 
 type MakeColonyState struct {
@@ -38,7 +44,7 @@ func (m *MakeColonyState) Tick(c *Connection, frame int64) ConnectionState {
 	if m.start == 0 {
 		m.start = frame
 	}
-	if framesToDur(frame-m.start) >= options.makeColonyTime {
+	if c.game.rules.duration(frame-m.start) >= time.Duration(c.game.rules.MakeColonyTime) {
 		return Idle(m.System)
 	}
 	return m
@@ -47,6 +53,7 @@ func (m *MakeColonyState) Tick(c *Connection, frame int64) ConnectionState {
 func (m *MakeColonyState) Exit(c *Connection) {
 	m.System.colonizedBy = c
 	c.Printf("Established colony on %v.\n", m.System)
+	c.game.Publish(m.System, colonyEvent{owner: c.Name()})
 }
 
 func (m *MakeColonyState) FillStatus(c *Connection, s *status) {
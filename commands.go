@@ -147,13 +147,13 @@ are farther away take longer to communicate with.
 }
 
 type status struct {
-	State       string
-	GameCode    string
-	Balance     int
-	Bombs       int
-	Kills       int
-	Location    string
-	Description string
+	State       string `json:"state"`
+	GameCode    string `json:"game,omitempty"`
+	Balance     int    `json:"balance"`
+	Bombs       int    `json:"bombs"`
+	Kills       int    `json:"kills"`
+	Location    string `json:"location,omitempty"`
+	Description string `json:"description,omitempty"`
 }
 
 var statusTemplate = template.Must(template.New("status").Parse(`
@@ -185,7 +185,7 @@ var statusCommand = Command{
 			s.Bombs = conn.bombs
 			s.Kills = conn.kills
 		}
-		statusTemplate.Execute(conn, s)
+		conn.Emit(s)
 	},
 }
 
@@ -202,23 +202,30 @@ func BroadcastCommand(sys *System) Command {
 		summary: "broadcast a message for all systems to hear",
 		handler: func(c *Connection, args ...string) {
 			msg := strings.Join(args, " ")
-			b := NewBroadcast(sys, msg)
 			log_info("player %s send broadcast from system %v: %v\n", c.Name(), sys, msg)
-			c.game.Register(b)
+			c.game.Publish(sys, broadcastEvent{message: msg})
 		},
 	}
 }
 
 func NearbyCommand(sys *System) Command {
 	handler := func(c *Connection, args ...string) {
-		neighbors := c.game.galaxy.Neighborhood(sys)
+		neighbors := c.game.galaxy.Nearest(sys, 25)
+		// the name column takes whatever room the other columns leave
+		nameWidth := c.Width() - 60
+		if nameWidth < 12 {
+			nameWidth = 12
+		}
+		if nameWidth > 40 {
+			nameWidth = 40
+		}
 		c.Line()
-		c.Printf("%-4s %-20s %-12s %s\n", "id", "name", "distance", "trip time")
+		c.Printf("%-4s %-*s %-12s %s\n", "id", nameWidth, "name", "distance", "trip time")
 		c.Line()
-		for _, neighbor := range neighbors[:25] {
+		for _, neighbor := range neighbors {
 			other := c.game.galaxy.GetSystemByID(neighbor.id)
-			dur := NewTravel(c, sys, other).(*TravelState).tripTime()
-			c.Printf("%-4d %-20s %-12.6vpc %v\n", other.id, other.name, neighbor.distance, dur)
+			dur := c.game.rules.tripTime(neighbor.distance)
+			c.Printf("%-4d %-*s %-12.6vpc %v\n", other.id, nameWidth, truncate(other.name, nameWidth), neighbor.distance, dur)
 		}
 		c.Line()
 	}
@@ -230,6 +237,16 @@ func NearbyCommand(sys *System) Command {
 	}
 }
 
+// truncate shortens s to at most n characters, marking it with a tilde if
+// anything was cut.
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "~"
+}
+
 var winCommand = Command{
 	name:    "win",
 	summary: "win the game.",
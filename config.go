@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// config is the server's config file. It sets the server's defaults, using
+// the same names as the command line flags, and defines the rule sets that
+// games can be started with, e.g.:
+//
+//	{
+//	    "options": {"ssh-addr": ":9222", "rules": "blitz", "bomb-cost": 600},
+//	    "rules": {
+//	        "marathon": {"economic": 100000, "respawn_time": "2m"},
+//	        "deep-space": {"catalog": "./hygdata.csv", "galaxy_size": 2000}
+//	    }
+//	}
+//
+// Flags given on the command line take precedence over the config file. A
+// rule set in the config file replaces any built-in rule set of the same name.
+type config struct {
+	Options map[string]json.RawMessage `json:"options"`
+	Rules   map[string]json.RawMessage `json:"rules"`
+}
+
+// loadConfig reads the config file at the given path and applies it.
+func loadConfig(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read config file: %v", err)
+	}
+	var c config
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return fmt.Errorf("unable to parse config file %s: %v", path, err)
+	}
+
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for name, raw := range c.Options {
+		if flag.Lookup(name) == nil {
+			return fmt.Errorf("unknown option in config file: %s", name)
+		}
+		if set[name] {
+			continue
+		}
+		value := string(raw)
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			value = s
+		}
+		if err := flag.Set(name, value); err != nil {
+			return fmt.Errorf("bad value for option %s in config file: %v", name, err)
+		}
+	}
+
+	for name, overrides := range c.Rules {
+		ruleSets[name] = overrides
+	}
+	return nil
+}
+
+// checkRuleSets makes sure that every rule set can be played, that their star
+// catalogs can be read, and that the default rule set exists, so that a bad
+// config is caught at startup rather than when a player starts a game.
+func checkRuleSets() error {
+	for _, name := range ruleSetNames() {
+		rules, err := lookupRules(name)
+		if err != nil {
+			return err
+		}
+		if rules.Catalog != "" {
+			if _, err := loadCatalog(rules.Catalog, rules.CatalogFormat); err != nil {
+				return fmt.Errorf("bad rule set %s: %v", name, err)
+			}
+		}
+	}
+	if _, ok := ruleSets[options.rules]; !ok {
+		return fmt.Errorf("no such rule set: %s", options.rules)
+	}
+	return nil
+}
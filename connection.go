@@ -1,41 +1,62 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
 	"io"
 	"net"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
 )
 
 type Connection struct {
-	*bufio.Reader
+	*link
 	game *Game
-	net.Conn
 	ConnectionState
 	bombs    int
 	colonies []*System
+	intel    intel
 	kills    int
-	lastBomb time.Time
-	lastScan time.Time
+	nextBomb int64 // frame on which the bomb launcher is reloaded
+	nextScan int64 // frame on which the scanner is recharged
 	money    int
 	profile  *Profile
+
+	token      string // lets the player resume their seat after a disconnect
+	detachedAt int64  // frame on which the player's socket went away; 0 while connected
+
+	choice *systemChoice // the systems the player was last asked to choose between
 }
 
 func NewConnection(conn net.Conn) *Connection {
-	c := &Connection{
-		Conn:   conn,
-		Reader: bufio.NewReader(conn),
-		bombs:  options.startBombs,
-		money:  options.startMoney,
-	}
+	c := newConnection(conn)
 	c.SetState(EnterLobby())
 	return c
 }
 
+// newConnection creates a connection without sending it to the lobby. A
+// connection created with a nil socket is headless.
+func newConnection(conn net.Conn) *Connection {
+	return &Connection{
+		link:  newLink(conn),
+		intel: make(intel),
+	}
+}
+
+// Write queues data to be written to the player's socket. Write is safe to
+// call from any goroutine. For players using the JSON protocol, the data is
+// wrapped in a text event.
+func (c *Connection) Write(b []byte) (int, error) {
+	if c.protocol == jsonProtocol {
+		c.Emit(textEvent{Text: string(b)})
+		return len(b), nil
+	}
+	return c.link.write(b)
+}
+
 func (c *Connection) Dead() bool {
 	return false
 }
@@ -71,6 +92,14 @@ func (c *Connection) RunCommand(name string, args ...string) {
 			}
 		}
 	}()
+	// a number picks one of the systems the player was asked to choose between
+	if choice := c.choice; choice != nil {
+		c.choice = nil
+		if n, err := strconv.Atoi(name); err == nil && len(args) == 0 && n >= 1 && n <= len(choice.options) {
+			name, args = choice.command, []string{strconv.Itoa(choice.options[n-1].id)}
+		}
+	}
+
 	switch name {
 	case "commands":
 		c.ListCommands()
@@ -85,6 +114,17 @@ func (c *Connection) RunCommand(name string, args ...string) {
 	cmd.handler(c, args...)
 }
 
+// dispatch runs a command read from the player's socket. Once a player is in a
+// game, their commands are run by the game itself, so that all game state is
+// only ever touched by the game's goroutine.
+func (c *Connection) dispatch(parts []string) {
+	if c.game != nil {
+		c.game.Submit(commandMessage{conn: c, name: parts[0], args: parts[1:]})
+	} else {
+		c.RunCommand(parts[0], parts[1:]...)
+	}
+}
+
 func (c *Connection) ListCommands() {
 	c.Printf("\n")
 	c.Line()
@@ -114,14 +154,16 @@ func (c *Connection) SetState(s ConnectionState) {
 	}
 	log_info("enter state: %v", s)
 	c.ConnectionState = s
+	c.Emit(stateEvent{State: s.String(), Location: c.Location().ref()})
 	s.Enter(c)
 }
 
-func (c *Connection) ReadLines(out chan []string) {
-	defer close(out)
-
+// ReadLines reads commands from the player until they hang up, handing each
+// one to handle. The next line isn't read until handle returns, so that a
+// command can read more input from the player itself, e.g. a password.
+func (c *Connection) ReadLines(handle func(parts []string)) {
 	for {
-		line, err := c.ReadString('\n')
+		parts, err := c.readCommand()
 		switch err {
 		case io.EOF:
 			return
@@ -131,31 +173,109 @@ func (c *Connection) ReadLines(out chan []string) {
 			log_error("unable to read line on connection: %v", err)
 			return
 		}
-		line = strings.TrimSpace(line)
-		if line == "" {
+		if len(parts) == 0 {
 			continue
 		}
-		out <- strings.Split(line, " ")
+		handle(parts)
+	}
+}
+
+// parseLine splits a line of input into a command name and its arguments.
+// Arguments are separated by spaces, except where they're quoted, so that a
+// name with spaces in it can be given as a single argument, e.g.
+//
+//	goto "HD 113538"
+//
+// A quote only opens at the beginning of a word, or just after the = of an
+// option such as center="HD 113538", so that apostrophes in chat needn't be
+// escaped. An argument whose quote is never closed runs to the end of the
+// line.
+func parseLine(line string) []string {
+	var (
+		parts   []string
+		current strings.Builder
+		inWord  bool
+		quote   rune
+	)
+	for _, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteRune(r)
+		case unicode.IsSpace(r):
+			if inWord {
+				parts = append(parts, current.String())
+				current.Reset()
+				inWord = false
+			}
+		case (r == '"' || r == '\'') && (!inWord || strings.HasSuffix(current.String(), "=")):
+			quote, inWord = r, true
+		default:
+			current.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		parts = append(parts, current.String())
 	}
+	return parts
+}
+
+// sizer is implemented by transports that know the width of the player's
+// terminal.
+type sizer interface {
+	width() int
+}
+
+const (
+	defaultWidth = 80
+	minWidth     = 40
+)
+
+// Width is the width of the player's terminal, in columns. Players whose
+// terminal hasn't told us its width are assumed to have 80 columns.
+func (c *Connection) Width() int {
+	if s, ok := c.Conn.(sizer); ok {
+		if w := s.width(); w >= minWidth {
+			return w
+		}
+	}
+	return defaultWidth
 }
 
 func (c *Connection) Line() {
-	c.Printf("--------------------------------------------------------------------------------\n")
+	c.Printf("%s\n", strings.Repeat("-", c.Width()))
 }
 
 func (c *Connection) Printf(template string, args ...interface{}) (int, error) {
 	return fmt.Fprintf(c, template, args...)
 }
 
+// Close hangs up on the player. Closing the socket ends the player's read
+// loop, which in turn notifies their game that they've left.
 func (c *Connection) Close() error {
 	log_info("player disconnecting: %s", c.Name())
-	if c.game != nil {
-		c.game.Quit(c)
-	}
-	if c.Conn != nil {
-		return c.Conn.Close()
+	return c.link.close()
+}
+
+// Location is the system that the player is currently at, or nil if the
+// player isn't at any system, e.g. because they're travelling or dead.
+func (c *Connection) Location() *System {
+	switch s := c.ConnectionState.(type) {
+	case *IdleState:
+		return s.System
+	case *MiningState:
+		return s.System
+	case *MakeBombState:
+		return s.System
+	case *MakeColonyState:
+		return s.System
+	case *MakeShieldState:
+		return s.System
+	default:
+		return nil
 	}
-	return nil
 }
 
 func (c *Connection) Name() string {
@@ -167,29 +287,33 @@ func (c *Connection) Name() string {
 
 func (c *Connection) RecordScan() {
 	c.Printf("Scanning known systems for signs of life\n")
-	c.lastScan = time.Now()
-	time.AfterFunc(options.scanTime, func() {
+	c.nextScan = c.game.frame + c.game.rules.frames(time.Duration(c.game.rules.ScanTime))
+	c.game.Schedule(c.nextScan, func(*Game) {
 		c.Printf("Scanner ready\n")
 	})
 }
 
 func (c *Connection) RecordBomb() {
-	c.lastBomb = time.Now()
-	time.AfterFunc(15*time.Second, func() {
+	c.nextBomb = c.game.frame + c.game.rules.frames(time.Duration(c.game.rules.BombReloadTime))
+	c.game.Schedule(c.nextBomb, func(*Game) {
 		fmt.Fprintln(c, "Bomb arsenal reloaded")
 	})
 }
 
 func (c *Connection) CanScan() bool {
-	return time.Since(c.lastScan) > options.scanTime
+	return c.game.frame >= c.nextScan
+}
+
+func (c *Connection) CanBomb() bool {
+	return c.game.frame >= c.nextBomb
 }
 
 func (c *Connection) NextScan() time.Duration {
-	return -time.Since(c.lastScan.Add(options.scanTime))
+	return c.game.rules.duration(c.nextScan - c.game.frame)
 }
 
 func (c *Connection) NextBomb() time.Duration {
-	return -time.Since(c.lastBomb.Add(15 * time.Second))
+	return c.game.rules.duration(c.nextBomb - c.game.frame)
 }
 
 func (c *Connection) MadeKill(victim *Connection) {
@@ -198,7 +322,7 @@ func (c *Connection) MadeKill(victim *Connection) {
 		return
 	}
 	c.kills += 1
-	if c.kills == 3 {
+	if c.kills == 3 && c.game.rules.canWin("military") {
 		c.Win("military")
 	}
 }
@@ -209,7 +333,7 @@ func (c *Connection) Withdraw(n int) {
 
 func (c *Connection) Deposit(n int) {
 	c.money += n
-	if c.money >= options.economic {
+	if c.money >= c.game.rules.Economic && c.game.rules.canWin("economic") {
 		c.Win("economic")
 	}
 }
@@ -3,7 +3,6 @@ package main
 import (
 	"database/sql"
 	_ "github.com/mattn/go-sqlite3"
-	"os"
 )
 
 var (
@@ -39,22 +38,70 @@ func planetsData() {
 		return
 	}
 	if n == 0 {
-		fi, err := os.Open(options.speckPath)
+		systems, err := readCatalog(options.catalog, options.catalogFormat)
 		if err != nil {
-			bail(E_No_Data, "unable to open data path: %v", err)
+			bail(E_No_Data, "%v\n", err)
 		}
-		c := make(chan System)
-		go speckStream(fi, c)
-		for planet := range c {
+		for _, planet := range systems {
 			planet.Store(db)
 		}
+		return
+	}
+	cleanPlanets()
+}
+
+// cleanPlanets cleans up the planets table of a database that the catalog was
+// imported into before catalogs were cleaned up on import. The systems that
+// are kept keep their ids, so games saved with them can still be restored.
+func cleanPlanets() {
+	stored := loadSystems()
+	systems := make([]System, len(stored))
+	byID := make(map[int]*System, len(stored))
+	for i, s := range stored {
+		systems[i] = *s
+		byID[s.id] = s
+	}
+	cleaned, report := cleanCatalog(systems)
+	if len(report) == 0 {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log_error("unable to clean up planets: %v", err)
+		return
+	}
+	for _, s := range cleaned {
+		if old := byID[s.id]; old.name != s.name || old.planets != s.planets {
+			if _, err := tx.Exec(`update planets set name = ?, planets = ? where id = ?`, s.name, s.planets, s.id); err != nil {
+				log_error("unable to clean up planets: %v", err)
+				tx.Rollback()
+				return
+			}
+		}
+		delete(byID, s.id)
+	}
+	for id := range byID {
+		if _, err := tx.Exec(`delete from planets where id = ?`, id); err != nil {
+			log_error("unable to clean up planets: %v", err)
+			tx.Rollback()
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log_error("unable to clean up planets: %v", err)
+		return
+	}
+	for _, line := range report {
+		log_info("planets table: %s", line)
 	}
-	// indexSystems()
 }
 
 func setupDb() {
 	planetsTable()
 	planetsData()
 	profilesTable()
+	profileKeysTable()
 	gamesTable()
+	snapshotsTable()
 }
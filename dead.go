@@ -18,6 +18,10 @@ func NewDeadState(died int64) ConnectionState {
 }
 
 func (d *DeadState) Enter(c *Connection) {
+	if c.protocol == jsonProtocol {
+		c.Emit(deathEvent{RespawnIn: time.Duration(c.game.rules.RespawnTime)})
+		return
+	}
 	msg := `
 Y88b   d88P                             d8888                                   
  Y88b d88P                             d88888                                   
@@ -66,16 +70,21 @@ Y88b   d88P                             d8888
     888  .d88P 888         d8888888888 888  .d88P 
     8888888P"  8888888888 d88P     888 8888888P"  
 `
+	// the death animation is played out on its own goroutine so that it
+	// doesn't hold up the game loop.
 	lines := strings.Split(msg, "\n")
-	for _, line := range lines {
-		c.Write([]byte(line + "\n"))
-		time.Sleep(20 * time.Millisecond)
-	}
+	l := c.link
+	go func() {
+		for _, line := range lines {
+			l.write([]byte(line + "\n"))
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
 }
 
 func (d *DeadState) Tick(c *Connection, frame int64) ConnectionState {
-	if frame-d.start > options.respawnFrames {
-		return c.game.SpawnPlayer()
+	if frame-d.start > c.game.rules.frames(time.Duration(c.game.rules.RespawnTime)) {
+		return c.game.SpawnPlayer(c)
 	}
 	return d
 }
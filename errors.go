@@ -11,27 +11,26 @@ const (
 	E_No_DB
 	E_No_Port
 	E_Bad_Duration
+	E_Replay_Failed
+	E_Bad_Config
 )
 
+// errorGroup is a list of errors that are reported together, one per line.
 type errorGroup []error
 
 func (e errorGroup) Error() string {
 	messages := make([]string, 0, len(e))
-	for i, _ := range e {
-		messages[i] = e[i].Error()
+	for _, err := range e {
+		messages = append(messages, err.Error())
 	}
-	return strings.Join(messages, " && ")
+	return strings.Join(messages, "\n")
 }
 
+// AddError adds an error to the group. nil errors are ignored.
 func (g *errorGroup) AddError(err error) {
-	if err == nil {
-		return
+	if err != nil {
+		*g = append(*g, err)
 	}
-	if g == nil {
-		panic("fart")
-		*g = make([]error, 0, 4)
-	}
-	*g = append(*g, err)
 }
 
 // ErrorState represents a valid client state indicating that the client has
@@ -3,53 +3,82 @@ package main
 import (
 	"math/rand"
 	"sort"
-	"strconv"
 )
 
 // Galaxy is a collection of systems
 type Galaxy struct {
 	systems map[int]*System
 	names   map[string]int
+	list    []*System // every system, ordered by id
+	index   *kdTree
 }
 
-func NewGalaxy() *Galaxy {
+// NewGalaxy builds a galaxy out of the star catalog given by the rules, or the
+// server's own catalog if they don't give one. If the rules give a shape, the
+// galaxy is generated instead.
+func NewGalaxy(rng *rand.Rand, rules Rules) *Galaxy {
+	return newGalaxy(galaxySystems(rng, rules), rng, rules)
+}
+
+// galaxySystems gives every system that a galaxy played by the rules is picked
+// from.
+func galaxySystems(rng *rand.Rand, rules Rules) []*System {
+	if rules.Shape != "" {
+		if rules.GalaxySeed != 0 {
+			rng = rand.New(rand.NewSource(rules.GalaxySeed))
+		}
+		return generateSystems(rng, rules)
+	}
+	if rules.Catalog == "" {
+		return loadSystems()
+	}
+	systems, err := loadCatalog(rules.Catalog, rules.CatalogFormat)
+	if err != nil {
+		log_error("unable to load catalog for rule set %s, using the server's catalog instead: %v", rules.Name, err)
+		return loadSystems()
+	}
+	return systems
+}
+
+// newGalaxy builds a galaxy out of a set of systems, seeding each system with
+// a random amount of money as given by the rules. If the rules limit the
+// extent of the galaxy, only the part of it they pick is used.
+func newGalaxy(systems []*System, rng *rand.Rand, rules Rules) *Galaxy {
+	systems = subset(systems, rng, rules)
 	g := &Galaxy{
-		systems: make(map[int]*System),
-		names:   make(map[string]int),
+		systems: make(map[int]*System, len(systems)),
+		names:   make(map[string]int, len(systems)),
 	}
-	g.indexSystems()
+	for _, s := range systems {
+		g.systems[s.id] = s
+		g.names[nameKey(s.name)] = s.id
+		s.money = int64(rng.NormFloat64()*rules.MoneySigma + rules.MoneyMean)
+	}
+	g.list = append([]*System{}, systems...)
+	sort.Slice(g.list, func(i, j int) bool { return g.list[i].id < g.list[j].id })
+	g.index = newKDTree(g.list)
 	return g
 }
 
-func (g *Galaxy) indexSystems() {
-	rows, err := db.Query(`select * from planets`)
+// loadSystems reads every system from the planets table, ordered by id.
+func loadSystems() []*System {
+	rows, err := db.Query(`select * from planets order by id`)
 	if err != nil {
 		log_error("unable to select all planets: %v", err)
-		return
+		return nil
 	}
 	defer rows.Close()
 
+	var systems []*System
 	for rows.Next() {
 		s := System{}
 		if err := rows.Scan(&s.id, &s.name, &s.x, &s.y, &s.z, &s.planets); err != nil {
 			log_info("unable to scan planet row: %v", err)
 			continue
 		}
-		g.systems[s.id] = &s
-		g.names[s.name] = s.id
-		s.money = int64(rand.NormFloat64()*options.moneySigma + options.moneyMean)
+		systems = append(systems, &s)
 	}
-}
-
-// GetSystem gets a system by either ID or name. If the provided string
-// contains an integer, we assume the lookup is intended to be by ID.
-func (g *Galaxy) GetSystem(s string) *System {
-	id, err := strconv.Atoi(s)
-	if err == nil {
-		return g.GetSystemByID(id)
-	}
-
-	return g.GetSystemByName(s)
+	return systems
 }
 
 func (g *Galaxy) GetSystemByID(id int) *System {
@@ -64,22 +93,40 @@ func (g *Galaxy) GetSystemByName(name string) *System {
 	return g.GetSystemByID(id)
 }
 
-func (g *Galaxy) SystemID(name string) int { return g.names[name] }
+// SystemID finds the id of the system with the given name, ignoring case and
+// spacing. It's 0 if there's no such system.
+func (g *Galaxy) SystemID(name string) int { return g.names[nameKey(name)] }
 
-// Neighborhood generates the neighborhood for a given system.
-func (g *Galaxy) Neighborhood(sys *System) Neighborhood {
-	neighbors := make(Neighborhood, 0, len(g.systems))
-	for id, sys2 := range g.systems {
-		if id == sys.id {
-			continue
+// Systems lists every system in the galaxy, ordered by id. The list is shared
+// and must not be modified.
+func (g *Galaxy) Systems() []*System { return g.list }
+
+// Neighbors walks every other system in the galaxy in order of distance from
+// the given one, nearest first.
+func (g *Galaxy) Neighbors(sys *System) *kdIter { return g.index.near(sys) }
+
+// Nearest lists the k systems closest to the given one, nearest first.
+func (g *Galaxy) Nearest(sys *System, k int) Neighborhood {
+	var neighbors Neighborhood
+	for it := g.Neighbors(sys); len(neighbors) < k; it.pop() {
+		n, ok := it.peek()
+		if !ok {
+			break
 		}
-		neighbors = append(neighbors, Neighbor{id: id, distance: sys.DistanceTo(sys2)})
+		neighbors = append(neighbors, n)
 	}
-	sort.Sort(neighbors)
 	return neighbors
 }
 
-func (g *Galaxy) randomSystem() *System {
-	id := rand.Intn(len(g.systems))
-	return g.GetSystemByID(id)
+// Within lists every other system no more than radius parsecs from the given
+// one, nearest first.
+func (g *Galaxy) Within(sys *System, radius float64) Neighborhood {
+	var neighbors Neighborhood
+	g.index.eachWithin(sys, radius, func(other *System, dist float64) {
+		if other != sys {
+			neighbors = append(neighbors, Neighbor{id: other.id, distance: dist})
+		}
+	})
+	sort.Sort(neighbors)
+	return neighbors
 }
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+)
+
+// galaxyShapes are the shapes that a generated galaxy can take.
+var galaxyShapes = []string{"clusters", "cube", "disc", "spiral"}
+
+const (
+	// defaultStars is the number of systems in a generated galaxy whose rules
+	// don't say.
+	defaultStars = 500
+
+	// defaultDensity is the number of systems per cubic parsec in a generated
+	// galaxy whose rules don't say, which puts most systems within about ten
+	// parsecs of their nearest neighbor.
+	defaultDensity = 0.001
+
+	// defaultPlanetMean is the mean number of planets per system in a
+	// generated galaxy whose rules don't say.
+	defaultPlanetMean = 1.5
+
+	// maxStars, maxDensity and maxPlanetMean are the most that rules may ask
+	// for. A galaxy is generated while new games wait, so it has to stay
+	// quick to make.
+	maxStars      = 20000
+	maxDensity    = 1.0
+	maxPlanetMean = 10.0
+
+	// spiralArms is the number of arms that a spiral galaxy has, and
+	// spiralTurns how many times each arm winds around the core.
+	spiralArms  = 2
+	spiralTurns = 0.75
+
+	// clusterStars is the mean number of systems in a cluster.
+	clusterStars = 25
+)
+
+// generateSystems builds the systems of a galaxy out of nothing, rather than
+// reading them from a star catalog. The galaxy takes the shape given by the
+// rules, and holds rules.Stars systems spread out to an average of
+// rules.Density systems per cubic parsec over its whole extent, although some
+// shapes pack them more tightly in places. The number of planets on each
+// system is one plus a Poisson-distributed number, so that the mean is
+// rules.PlanetMean. The same rules and rng always give the same systems.
+func generateSystems(rng *rand.Rand, rules Rules) []*System {
+	stars, density, planetMean := rules.Stars, rules.Density, rules.PlanetMean
+	if stars == 0 {
+		stars = defaultStars
+	}
+	if density == 0 {
+		density = defaultDensity
+	}
+	if planetMean == 0 {
+		planetMean = defaultPlanetMean
+	}
+	volume := float64(stars) / density
+
+	var place func() (x, y, z float64)
+	switch rules.Shape {
+	case "disc":
+		// a disc a tenth as thick as it is wide
+		radius := math.Cbrt(5 * volume / math.Pi)
+		place = func() (float64, float64, float64) {
+			r, theta := radius*math.Sqrt(rng.Float64()), 2*math.Pi*rng.Float64()
+			return r * math.Cos(theta), r * math.Sin(theta), rng.NormFloat64() * radius / 20
+		}
+	case "spiral":
+		radius := math.Cbrt(5 * volume / math.Pi)
+		place = func() (float64, float64, float64) {
+			t := math.Sqrt(rng.Float64())
+			arm := float64(rng.Intn(spiralArms))
+			theta := 2*math.Pi*(arm/spiralArms+spiralTurns*t) + rng.NormFloat64()*0.25
+			r := radius * t
+			return r * math.Cos(theta), r * math.Sin(theta), rng.NormFloat64() * radius / 20
+		}
+	case "clusters":
+		side := math.Cbrt(volume)
+		n := stars/clusterStars + 1
+		centers := make([][3]float64, n)
+		for i := range centers {
+			centers[i] = [3]float64{(rng.Float64() - 0.5) * side, (rng.Float64() - 0.5) * side, (rng.Float64() - 0.5) * side}
+		}
+		spread := side / math.Cbrt(float64(n)) / 6
+		place = func() (float64, float64, float64) {
+			c := centers[rng.Intn(n)]
+			return c[0] + rng.NormFloat64()*spread, c[1] + rng.NormFloat64()*spread, c[2] + rng.NormFloat64()*spread
+		}
+	default: // cube
+		side := math.Cbrt(volume)
+		place = func() (float64, float64, float64) {
+			return (rng.Float64() - 0.5) * side, (rng.Float64() - 0.5) * side, (rng.Float64() - 0.5) * side
+		}
+	}
+
+	names := make(map[string]bool, stars)
+	systems := make([]*System, stars)
+	for i := range systems {
+		x, y, z := place()
+		systems[i] = &System{
+			id:      i + 1,
+			name:    starName(rng, names),
+			x:       x,
+			y:       y,
+			z:       z,
+			planets: 1 + poisson(rng, planetMean-1),
+		}
+	}
+	return systems
+}
+
+var nameSyllables = []string{
+	"al", "an", "ar", "be", "bel", "ca", "cor", "da", "del", "do", "el", "en",
+	"fa", "ga", "gor", "ha", "i", "ka", "kel", "lo", "lu", "ma", "mir", "na",
+	"nor", "o", "pa", "qua", "ra", "ri", "sa", "sol", "ta", "tor", "u", "va",
+	"vel", "xe", "ya", "ze",
+}
+
+// starName makes up a name for a star that isn't among those already taken,
+// and takes it.
+func starName(rng *rand.Rand, taken map[string]bool) string {
+	var name string
+	for attempt := 0; attempt < 20; attempt++ {
+		var b strings.Builder
+		for i, n := 0, 2+rng.Intn(2); i < n; i++ {
+			b.WriteString(nameSyllables[rng.Intn(len(nameSyllables))])
+		}
+		name = strings.ToUpper(b.String()[:1]) + b.String()[1:]
+		if attempt > 10 {
+			// the galaxy is so big that names are running out
+			name += "-" + strings.ToUpper(nameSyllables[rng.Intn(len(nameSyllables))])
+		}
+		if !taken[name] {
+			taken[name] = true
+			return name
+		}
+	}
+	// the names have all but run out: number the last one tried instead
+	for n := len(taken) + 1; ; n++ {
+		if numbered := fmt.Sprintf("%s-%d", name, n); !taken[numbered] {
+			taken[numbered] = true
+			return numbered
+		}
+	}
+}
+
+// poisson draws a number from a Poisson distribution with the given mean.
+func poisson(rng *rand.Rand, mean float64) int {
+	if mean <= 0 {
+		return 0
+	}
+	limit, n, p := math.Exp(-mean), 0, rng.Float64()
+	for p > limit {
+		n++
+		p *= rng.Float64()
+	}
+	return n
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestGenerateGalaxy(t *testing.T) {
+	for _, shape := range galaxyShapes {
+		rules := defaultRules()
+		rules.Shape, rules.Stars, rules.PlanetMean = shape, 400, 2
+		systems := generateSystems(rand.New(rand.NewSource(1)), rules)
+		if len(systems) != 400 {
+			t.Fatalf("%s: expected 400 systems, got %d", shape, len(systems))
+		}
+
+		names := make(map[string]bool)
+		planets := 0
+		var extent float64
+		for i, sys := range systems {
+			if sys.id != i+1 {
+				t.Fatalf("%s: system %d has id %d", shape, i, sys.id)
+			}
+			if names[sys.name] {
+				t.Fatalf("%s: more than one system is named %s", shape, sys.name)
+			}
+			names[sys.name] = true
+			if sys.planets < 1 {
+				t.Fatalf("%s: %v has no planets", shape, sys)
+			}
+			planets += sys.planets
+			extent = math.Max(extent, math.Sqrt(sq(sys.x)+sq(sys.y)+sq(sys.z)))
+		}
+		if mean := float64(planets) / 400; math.Abs(mean-2) > 0.25 {
+			t.Errorf("%s: expected about 2 planets per system, got %.2f", shape, mean)
+		}
+		// 400 systems at 0.001 per cubic parsec take up 400,000 cubic parsecs,
+		// which is a sphere about 45 parsecs across.
+		if extent < 30 || extent > 200 {
+			t.Errorf("%s: galaxy reaches out %.0f parsecs, which doesn't fit its density", shape, extent)
+		}
+	}
+}
+
+func TestGenerateGalaxyIsRepeatable(t *testing.T) {
+	rules := defaultRules()
+	rules.Shape, rules.Stars = "spiral", 50
+	a := generateSystems(rand.New(rand.NewSource(7)), rules)
+	b := generateSystems(rand.New(rand.NewSource(7)), rules)
+	for i := range a {
+		if a[i].name != b[i].name || a[i].x != b[i].x || a[i].y != b[i].y || a[i].z != b[i].z || a[i].planets != b[i].planets {
+			t.Fatalf("the same seed generated %+v and %+v", a[i], b[i])
+		}
+	}
+
+	rules.GalaxySeed = 99
+	g1 := NewGalaxy(rand.New(rand.NewSource(1)), rules)
+	g2 := NewGalaxy(rand.New(rand.NewSource(2)), rules)
+	if g1.GetSystemByID(1).name != g2.GetSystemByID(1).name || g1.GetSystemByID(1).x != g2.GetSystemByID(1).x {
+		t.Fatalf("games with the same galaxy seed got different galaxies")
+	}
+}
+
+func TestTinyRules(t *testing.T) {
+	s, err := parseGameSettings([]string{"tiny"})
+	if err != nil {
+		t.Fatalf("unable to use the tiny rule set: %v", err)
+	}
+	g := NewGame(1, newManualClock(time.Unix(0, 0)), s.rules)
+	if n := len(g.galaxy.Systems()); n != 20 {
+		t.Fatalf("expected a tiny galaxy of 20 systems, got %d", n)
+	}
+
+	if _, err := parseGameSettings([]string{"shape=torus"}); err == nil {
+		t.Fatalf("expected an unknown shape to be rejected")
+	}
+	s, err = parseGameSettings([]string{"shape=disc", "stars=30", "density=0.01", "planets=3", "seed=5"})
+	if err != nil {
+		t.Fatalf("unable to parse galaxy options: %v", err)
+	}
+	if s.rules.Shape != "disc" || s.rules.Stars != 30 || s.rules.Density != 0.01 || s.rules.PlanetMean != 3 || s.rules.GalaxySeed != 5 {
+		t.Fatalf("galaxy options were parsed wrong: %+v", s.rules)
+	}
+
+	// a galaxy is generated while new games wait for it, so it can't be huge
+	for _, args := range [][]string{
+		{"shape=cube", "stars=500000000"},
+		{"shape=cube", "stars=20001"},
+		{"shape=cube", "density=1.5"},
+		{"shape=cube", "planets=11"},
+	} {
+		if _, err := parseGameSettings(args); err == nil {
+			t.Errorf("expected %v to be rejected", args)
+		}
+	}
+	if _, err := parseGameSettings([]string{"shape=cube", "stars=20000", "density=1", "planets=10"}); err != nil {
+		t.Fatalf("expected the largest galaxy options to be allowed: %v", err)
+	}
+}
+
+func TestStarNamesRunOut(t *testing.T) {
+	// each name starName tries from a fresh copy of the same rng is taken in
+	// turn, until it has tried them all and has to make one up
+	taken := make(map[string]bool)
+	numbered := regexp.MustCompile(`-[0-9]+$`)
+	var name string
+	for i := 0; i < 25 && !numbered.MatchString(name); i++ {
+		name = starName(rand.New(rand.NewSource(3)), taken)
+	}
+	if !numbered.MatchString(name) {
+		t.Fatalf("expected starName to fall back to a numbered name once the names it tries are taken, it gave %q", name)
+	}
+	n := len(taken)
+	again := starName(rand.New(rand.NewSource(3)), taken)
+	if again == name || !numbered.MatchString(again) || len(taken) != n+1 {
+		t.Fatalf("expected another numbered name after %q, got %q", name, again)
+	}
+}
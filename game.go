@@ -1,22 +1,42 @@
 package main
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"math/rand"
+	"sort"
 	"time"
 )
 
 type Game struct {
 	id          string
+	seed        int64
+	rng         *rand.Rand
+	rules       Rules
+	maxPlayers  int       // the most seats the game has, or 0 for no limit
+	password    []byte    // hash of the password needed to join, or nil
+	started     bool      // whether the game has left its staging room
+	host        string    // the player who may start the game
+	startAt     time.Time // when the countdown to the start ends, if it's running
+	announced   int       // the last second of the countdown announced to players
+	clock       Clock
 	start       time.Time
 	end         time.Time
 	done        chan interface{}
+	inbox       chan GameMessage
 	winner      string
 	winMethod   string
 	connections map[*Connection]bool
+	aliases     map[*Connection]*Connection // lobby connections that have reclaimed a seat
 	frame       int64
-	elems       map[GameElement]bool
+	elems       []GameElement
 	galaxy      *Galaxy
+	schedule    schedule
+	scheduleSeq uint64
+	log         *gameLog
+
+	// called once when the game has been won, to persist the outcome.
+	onEnd func(*Game)
 }
 
 func gamesTable() {
@@ -32,30 +52,43 @@ func gamesTable() {
 	}
 }
 
-func init() { rand.Seed(time.Now().UnixNano()) }
-
-func newID() string {
+func newID(rng *rand.Rand) string {
 	chars := []rune("ABCDEEEEEEEEFGHJJJJJJJKMNPQQQQQQQRTUVWXXXXXYZZZZZ234677777789")
 	id := make([]rune, 0, 4)
 	for i := 0; i < cap(id); i++ {
-		id = append(id, chars[rand.Intn(len(chars))])
+		id = append(id, chars[rng.Intn(len(chars))])
 	}
 	return string(id)
 }
 
-func NewGame() *Game {
+// NewGame creates a game. Every random decision made in the game is drawn
+// from a random number generator seeded with the given seed, so that two
+// games created with the same seed and given the same commands on the same
+// frames play out identically, as long as they're played by the same rules.
+func NewGame(seed int64, clock Clock, rules Rules) *Game {
+	return newGame(seed, clock, rules, NewGalaxy)
+}
+
+// newGame creates a game whose galaxy is built by the given function, which
+// is handed the game's random number generator and rules.
+func newGame(seed int64, clock Clock, rules Rules, mkGalaxy func(*rand.Rand, Rules) *Galaxy) *Game {
+	rng := rand.New(rand.NewSource(seed))
 	game := &Game{
-		id:          newID(),
-		start:       time.Now(),
+		id:          newID(rng),
+		seed:        seed,
+		rng:         rng,
+		rules:       rules,
+		clock:       clock,
+		start:       clock.Now(),
 		done:        make(chan interface{}),
+		inbox:       make(chan GameMessage, 256),
 		connections: make(map[*Connection]bool, 32),
-		elems:       make(map[GameElement]bool, 32),
-		galaxy:      NewGalaxy(),
-	}
-	if err := game.Create(); err != nil {
-		log_error("unable to create game: %v", err)
+		aliases:     make(map[*Connection]*Connection),
+		elems:       make([]GameElement, 0, 1024),
 	}
-	for _, system := range game.galaxy.systems {
+	game.galaxy = mkGalaxy(rng, rules)
+	log_info("created game %s with seed %d and %s rules", game.id, game.seed, rules.Name)
+	for _, system := range game.galaxy.Systems() {
 		game.Register(system)
 	}
 	return game
@@ -69,7 +102,7 @@ func (g *Game) Create() error {
         (?, ?)
     ;`, g.id, g.start)
 	if err != nil {
-		return fmt.Errorf("error writing sqlite insert statement to create game: %v")
+		return fmt.Errorf("error writing sqlite insert statement to create game: %v", err)
 	}
 	return nil
 }
@@ -85,42 +118,211 @@ func (g *Game) Store() error {
 
 func (g *Game) Join(conn *Connection) {
 	log_info("Player %s has joined game %s", conn.Name(), g.id)
+	if g.host == "" {
+		g.host = conn.Name()
+	}
 	for there, _ := range g.connections {
 		there.Printf("Player %s has joined the game", conn.Name())
 	}
 	g.connections[conn] = true
 	g.Register(conn)
+	conn.money = g.rules.StartMoney
+	conn.bombs = g.rules.StartBombs
+	conn.token = newResumeToken()
+	conn.Emit(sessionEvent{Game: g.id, Token: conn.token})
+}
+
+// seatOf finds the seat of the player with the given name.
+func (g *Game) seatOf(name string) *Connection {
+	for conn := range g.connections {
+		if conn.Name() == name {
+			return conn
+		}
+	}
+	return nil
+}
+
+// Reclaim hands a player's seat to a newly connected player. From here on,
+// the newcomer's socket is attached to the seat, and anything they send is
+// applied to the seat. If somebody was still connected to the seat, they're
+// disconnected.
+func (g *Game) Reclaim(seat, conn *Connection) {
+	log_info("Player %s has reclaimed their seat in game %s", conn.Name(), g.id)
+	old := seat.link
+	seat.link = conn.link
+	seat.detachedAt = 0
+	old.close()
+	g.aliases[conn] = seat
+	for there := range g.connections {
+		if there != seat {
+			there.Printf("Player %s has rejoined the game\n", seat.Name())
+		}
+	}
+	seat.Printf("Welcome back. You have reclaimed your seat: %v\n", seat.ConnectionState)
+	seat.Emit(sessionEvent{Game: g.id, Token: seat.token})
+}
+
+// Detach keeps the seat of a player whose socket has gone away, so that they
+// can reclaim it if they come back within options.resumeGrace. In the
+// meantime, their ship carries on doing whatever it was doing.
+func (g *Game) Detach(seat *Connection) {
+	log_info("Player %s has been disconnected from game %s", seat.Name(), g.id)
+	seat.link = newLink(nil)
+	seat.detachedAt = g.frame
+	for there := range g.connections {
+		if there != seat {
+			there.Printf("Player %s has lost their connection\n", seat.Name())
+		}
+	}
+}
+
+// expireSeats removes the players that have been disconnected for longer than
+// options.resumeGrace.
+func (g *Game) expireSeats() {
+	var expired []*Connection
+	for conn := range g.connections {
+		if conn.detachedAt > 0 && g.frame-conn.detachedAt >= g.rules.frames(options.resumeGrace) {
+			expired = append(expired, conn)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool { return expired[i].Name() < expired[j].Name() })
+	for _, conn := range expired {
+		g.record(logEntry{Type: "quit", Player: conn.Name()})
+		g.Quit(conn)
+		conn.link.close()
+	}
+}
+
+// TokenOwner finds the profile of the player whose seat has the given resume
+// token, or nil if no seat in the game has it. It's safe to call from outside
+// of the game's goroutine.
+func (g *Game) TokenOwner(token string) *Profile {
+	reply := make(chan *Profile, 1)
+	ok := g.Submit(queryMessage(func(g *Game) {
+		for conn := range g.connections {
+			if conn.token != "" && subtle.ConstantTimeCompare([]byte(conn.token), []byte(token)) == 1 {
+				reply <- conn.profile
+				return
+			}
+		}
+		reply <- nil
+	}))
+	if !ok {
+		return nil
+	}
+	select {
+	case p := <-reply:
+		return p
+	case <-g.done:
+		return nil
+	}
+}
+
+// resolve finds the seat that a connection is playing in.
+func (g *Game) resolve(conn *Connection) *Connection {
+	if seat, ok := g.aliases[conn]; ok {
+		return seat
+	}
+	return conn
 }
 
 func (g *Game) Quit(conn *Connection) {
+	log_info("Player %s has left game %s", conn.Name(), g.id)
+	if sys := conn.Location(); sys != nil {
+		sys.Leave(conn)
+	}
 	delete(g.connections, conn)
+	for i, elem := range g.elems {
+		if elem == GameElement(conn) {
+			g.elems = append(g.elems[:i], g.elems[i+1:]...)
+			break
+		}
+	}
+}
+
+// Submit queues a message to be applied on the game's goroutine at the start
+// of the next frame. Submit returns false if the game has already ended and
+// the message will never be applied. Submit must not be called from the
+// game's own goroutine, since it blocks when the inbox is full.
+func (g *Game) Submit(m GameMessage) bool {
+	select {
+	case g.inbox <- m:
+		return true
+	case <-g.done:
+		return false
+	}
+}
+
+// PlayerNames lists the names of the players in the game. It's safe to call
+// from outside of the game's goroutine.
+func (g *Game) PlayerNames() []string {
+	reply := make(chan []string, 1)
+	ok := g.Submit(queryMessage(func(g *Game) {
+		names := make([]string, 0, len(g.connections))
+		for conn := range g.connections {
+			names = append(names, conn.Name())
+		}
+		reply <- names
+	}))
+	if !ok {
+		return nil
+	}
+	select {
+	case names := <-reply:
+		return names
+	case <-g.done:
+		return nil
+	}
 }
 
 func (g *Game) Win(winner *Connection, method string) {
+	if g.winner != "" || g.over() {
+		return
+	}
 	defer close(g.done)
-	g.end = time.Now()
+	g.end = g.clock.Now()
 	g.winner = winner.Name()
 	g.winMethod = method
-	g.Store()
+	g.record(logEntry{Type: "end", Winner: g.winner, Method: method})
 
 	log_info("player %s has won by %s victory", winner.Name(), method)
 
 	for conn, _ := range g.connections {
-		conn.Printf("player %s has won by %s victory.\n", winner.Name(), method)
+		conn.Emit(victoryEvent{Winner: winner.Name(), Method: method})
+	}
+
+	if g.onEnd != nil {
+		g.onEnd(g)
+	}
+}
+
+// over checks whether the game has finished, either because somebody won or
+// because the server is shutting down.
+func (g *Game) over() bool {
+	select {
+	case <-g.done:
+		return true
+	default:
+		return false
 	}
+}
 
-	gm.Remove(g)
+// record appends an entry to the game's log, stamped with the current frame.
+func (g *Game) record(e logEntry) {
+	e.Frame = g.frame
+	g.log.write(e)
 }
 
 func (g *Game) Reset() {
 	connections := g.connections
-	fresh := NewGame()
+	fresh := NewGame(g.rng.Int63(), g.clock, g.rules)
 	*g = *fresh
 	g.connections = connections
 }
 
 func (g *Game) Run() {
-	ticker := time.Tick(time.Second / time.Duration(options.frameRate))
+	ticker, stop := g.clock.Ticker(g.rules.frameLength())
+	defer stop()
 	for {
 		select {
 		case <-ticker:
@@ -134,25 +336,90 @@ func (g *Game) Run() {
 	}
 }
 
+// Register adds an element to the game. Elements are ticked in the order in
+// which they were registered.
 func (g *Game) Register(elem GameElement) {
-	g.elems[elem] = true
+	g.elems = append(g.elems, elem)
+}
+
+// Step advances the game by n frames, synchronously. This is how a game with
+// a manual clock is driven.
+func (g *Game) Step(n int) {
+	for i := 0; i < n; i++ {
+		if c, ok := g.clock.(*manualClock); ok {
+			c.Advance(g.rules.frameLength())
+		}
+		g.tick()
+	}
 }
 
 func (g *Game) tick() {
+	if g.over() {
+		return
+	}
+	if !g.started {
+		// no time passes in the game while it's in its staging room.
+		g.drain()
+		g.stage()
+		return
+	}
 	g.frame += 1
-	for elem := range g.elems {
-		elem.Tick(g)
+	g.drain()
+	g.expireSeats()
+	g.update()
+}
+
+// update runs everything that happens within a frame once the frame's
+// messages have been applied.
+func (g *Game) update() {
+	g.runScheduled()
+	// elements registered during the frame are appended to the list and
+	// ticked in this same pass
+	for i := 0; i < len(g.elems); i++ {
+		g.elems[i].Tick(g)
 	}
-	for elem := range g.elems {
+	live := g.elems[:0]
+	for _, elem := range g.elems {
 		if elem.Dead() {
 			log_info("delete game object: %v", elem)
-			delete(g.elems, elem)
+			continue
 		}
+		live = append(live, elem)
 	}
+	for i := len(live); i < len(g.elems); i++ {
+		g.elems[i] = nil
+	}
+	g.elems = live
 }
 
-func (g *Game) SpawnPlayer() ConnectionState {
-	return Idle(g.galaxy.randomSystem())
+// drain applies every message that has been queued since the last frame.
+// Messages queued behind one that ends the game are never applied.
+func (g *Game) drain() {
+	for !g.over() {
+		select {
+		case m := <-g.inbox:
+			m.Apply(g)
+		default:
+			return
+		}
+	}
+}
+
+// SpawnPlayer places a player that's joining the game or coming back from the
+// dead, as far from the other players as the spawn planner can manage.
+func (g *Game) SpawnPlayer(conn *Connection) ConnectionState {
+	var occupied []*System
+	for other := range g.connections {
+		if other == conn {
+			continue
+		}
+		if sys := other.Location(); sys != nil {
+			occupied = append(occupied, sys)
+		} else if t, ok := other.ConnectionState.(*TravelState); ok {
+			occupied = append(occupied, t.dest)
+		}
+	}
+	return Idle(g.galaxy.planSpawns(g.rng, 1, g.rules.SpawnDistance, occupied)[0])
 }
 
 type GameElement interface {
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"sort"
 	"sync"
+	"time"
 )
 
 var gm *GameManager
@@ -17,15 +19,92 @@ type GameManager struct {
 	sync.Mutex
 }
 
-func (g *GameManager) NewGame() *Game {
+// NewGame starts a game with the given settings.
+func (g *GameManager) NewGame(settings gameSettings) *Game {
 	g.Lock()
 	defer g.Unlock()
 
-	game := NewGame()
-	g.games[game.id] = game
+	game := NewGame(time.Now().UnixNano(), wallClock{}, settings.rules)
+	game.maxPlayers = settings.maxPlayers
+	game.password = settings.password
+	if err := game.Create(); err != nil {
+		log_error("unable to create game: %v", err)
+	}
+	l, err := createGameLog(game)
+	if err != nil {
+		log_error("game %s will not be recorded: %v", game.id, err)
+	}
+	game.log = l
+	g.manage(game)
 	return game
 }
 
+// manage puts a game under the manager's care. The manager's lock must be
+// held.
+func (g *GameManager) manage(game *Game) {
+	game.onEnd = func(game *Game) {
+		if err := game.Store(); err != nil {
+			log_error("unable to store game %s: %v", game.id, err)
+		}
+		if err := game.DeleteSnapshot(); err != nil {
+			log_error("unable to delete snapshot of game %s: %v", game.id, err)
+		}
+		game.log.Close()
+		g.Remove(game)
+	}
+	game.scheduleSnapshots()
+	g.games[game.id] = game
+}
+
+// Restore brings back every unfinished game that has a stored snapshot and
+// starts running it.
+func (g *GameManager) Restore() {
+	snaps, err := loadSnapshots()
+	if err != nil {
+		log_error("unable to restore games: %v", err)
+		return
+	}
+
+	g.Lock()
+	defer g.Unlock()
+	for _, snap := range snaps {
+		game, err := restoreGame(snap, wallClock{})
+		if err != nil {
+			log_error("unable to restore game %s: %v", snap.Game, err)
+			continue
+		}
+		l, err := resumeGameLog(game)
+		if err != nil {
+			log_error("game %s will not be recorded: %v", game.id, err)
+		}
+		game.log = l
+		g.manage(game)
+		log_info("restored game %s on frame %d with %d players", game.id, game.frame, len(game.connections))
+		go game.Run()
+	}
+}
+
+// Announce sends an event to every player in every game.
+func (g *GameManager) Announce(e event) {
+	for _, game := range g.List() {
+		game.Submit(queryMessage(func(game *Game) {
+			for conn := range game.connections {
+				conn.Emit(e)
+			}
+		}))
+	}
+}
+
+// Shutdown stops every game, saving the games that are still being played so
+// that they can be restored when the server next starts.
+func (g *GameManager) Shutdown() {
+	for _, game := range g.List() {
+		if game.Submit(shutdownMessage{}) {
+			<-game.done
+		}
+	}
+}
+
 func (g *GameManager) Get(id string) *Game {
 	g.Lock()
 	defer g.Unlock()
@@ -39,3 +118,18 @@ func (g *GameManager) Remove(game *Game) {
 
 	delete(g.games, game.id)
 }
+
+// List returns the games currently being managed, ordered by id. The games are
+// returned as a copy so that callers can talk to each game without holding the
+// manager's lock.
+func (g *GameManager) List() []*Game {
+	g.Lock()
+	defer g.Unlock()
+
+	games := make([]*Game, 0, len(g.games))
+	for _, game := range g.games {
+		games = append(games, game)
+	}
+	sort.Slice(games, func(i, j int) bool { return games[i].id < games[j].id })
+	return games
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// playSeed plays a short game from the given seed, with a fixed script of
+// commands, and returns the state of the game after every hundred frames.
+func playSeed(t *testing.T, seed int64) (string, []string) {
+	rules := defaultRules()
+	rules.Shape, rules.Stars = "cube", 30
+	g := NewGame(seed, newManualClock(time.Unix(0, 0)), rules)
+	h := &harness{t: t, game: g}
+
+	alice := h.Stage("alice")
+	bob := h.Stage("bob")
+	carol := h.Stage("carol")
+	bob.Send("ready")
+	carol.Send("ready")
+	h.Step(1)
+	alice.Send("start")
+	h.Step(1)
+	if !g.started {
+		t.Fatalf("the game from seed %d didn't start", seed)
+	}
+
+	alice.Send("mine")
+	bob.Send("scan")
+	bob.Send("bomb 7")
+	carol.Send("goto 12")
+	h.Step(100)
+	carol.Send("broadcast hello")
+	alice.Send("goto 3")
+
+	var states []string
+	for i := 0; i < 5; i++ {
+		h.Step(100)
+		states = append(states, gameState(g))
+	}
+	return g.id, states
+}
+
+func TestSameSeedSameGame(t *testing.T) {
+	id, states := playSeed(t, 42)
+	againID, again := playSeed(t, 42)
+	if id != againID {
+		t.Fatalf("two games from the same seed got different ids: %s and %s", id, againID)
+	}
+	for i := range states {
+		if states[i] != again[i] {
+			t.Fatalf("two games from the same seed differ after %d frames.\nfirst:\n%s\nsecond:\n%s", (i+1)*100, states[i], again[i])
+		}
+	}
+
+	otherID, other := playSeed(t, 43)
+	if otherID == id || other[0] == states[0] {
+		t.Fatalf("games from different seeds came out the same")
+	}
+}
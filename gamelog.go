@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// logEntry is a single line in a game log. The first line of every log is a
+// "start" entry that carries the game's seed and rules; every line after
+// that records something that happened to the game from the outside, stamped
+// with the frame on which it was applied.
+type logEntry struct {
+	Frame   int64    `json:"frame"`
+	Type    string   `json:"type"`
+	Game    string   `json:"game,omitempty"`
+	Seed    int64    `json:"seed,omitempty"`
+	Config  *Rules   `json:"config,omitempty"`
+	Player  string   `json:"player,omitempty"`
+	Command string   `json:"command,omitempty"`
+	Args    []string `json:"args,omitempty"`
+	Winner  string   `json:"winner,omitempty"`
+	Method  string   `json:"method,omitempty"`
+}
+
+// gameLog is an append-only record of a game.
+type gameLog struct {
+	f   *os.File
+	enc *json.Encoder
+}
+
+func gameLogPath(id string) string {
+	return filepath.Join(options.gameLogDir, id+".log")
+}
+
+// createGameLog starts the log for a new game.
+func createGameLog(g *Game) (*gameLog, error) {
+	rules := g.rules
+	return openGameLog(g, logEntry{Type: "start", Game: g.id, Seed: g.seed, Config: &rules})
+}
+
+// resumeGameLog reopens the log of a game that has been restored from a
+// snapshot. Since the state of the game's random number generator is lost
+// when the game is restored, the log can't be replayed past this point.
+func resumeGameLog(g *Game) (*gameLog, error) {
+	return openGameLog(g, logEntry{Frame: g.frame, Type: "resume", Game: g.id})
+}
+
+func openGameLog(g *Game, first logEntry) (*gameLog, error) {
+	if err := os.MkdirAll(options.gameLogDir, 0755); err != nil {
+		return nil, fmt.Errorf("unable to create game log directory: %v", err)
+	}
+	f, err := os.OpenFile(gameLogPath(g.id), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open game log: %v", err)
+	}
+	l := &gameLog{f: f, enc: json.NewEncoder(f)}
+	l.write(first)
+	return l, nil
+}
+
+func (l *gameLog) write(e logEntry) {
+	if l == nil {
+		return
+	}
+	if err := l.enc.Encode(e); err != nil {
+		log_error("unable to write game log entry: %v", err)
+	}
+}
+
+func (l *gameLog) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.f.Close()
+}
+
+// readGameLog reads every entry in a game log.
+func readGameLog(r io.Reader) ([]logEntry, error) {
+	var entries []logEntry
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; s.Scan(); n++ {
+		var e logEntry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("bad game log entry on line %d: %v", n, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read game log: %v", err)
+	}
+	if len(entries) == 0 || entries[0].Type != "start" {
+		return nil, fmt.Errorf("game log is missing its start entry")
+	}
+	return entries, nil
+}
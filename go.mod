@@ -1,5 +1,12 @@
 module github.com/jordanorelli/exo
 
-go 1.12
+go 1.23.0
 
-require github.com/mattn/go-sqlite3 v1.10.0
+require (
+	github.com/gorilla/websocket v1.5.3
+	github.com/mattn/go-sqlite3 v1.10.0
+	golang.org/x/crypto v0.35.0
+	golang.org/x/term v0.29.0
+)
+
+require golang.org/x/sys v0.30.0 // indirect
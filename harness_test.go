@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// how long a client will wait to receive some expected output
+const expectTimeout = 2 * time.Second
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "exo-test")
+	if err != nil {
+		log.Fatalf("unable to create temp dir: %v", err)
+	}
+
+	flag.Parse()
+	info_log = log.New(ioutil.Discard, "[INFO] ", 0)
+	error_log = log.New(os.Stderr, "[ERROR] ", 0)
+	if testing.Verbose() {
+		info_log.SetOutput(os.Stdout)
+	}
+
+	options.gameLogDir = filepath.Join(dir, "game-logs")
+	passwordCost = bcrypt.MinCost
+	// games started from the lobby begin as soon as their host says so
+	options.startCountdown = 0
+
+	db, err = sql.Open("sqlite3", filepath.Join(dir, "exo.db"))
+	if err != nil {
+		log.Fatalf("unable to open test db: %v", err)
+	}
+	setupDb()
+
+	status := m.Run()
+	db.Close()
+	os.RemoveAll(dir)
+	os.Exit(status)
+}
+
+// harness is a game running against a manual clock in a small, fixed galaxy,
+// for writing tests against.
+type harness struct {
+	t       *testing.T
+	game    *Game
+	systems []*System
+}
+
+// testSystem creates a system for a test galaxy.
+func testSystem(id int, name string, x, y, z float64) *System {
+	return &System{id: id, name: name, x: x, y: y, z: z, planets: 1}
+}
+
+// defaultTestGalaxy is a line of systems one parsec apart, starting at the
+// origin, plus one far away straggler.
+func defaultTestGalaxy() []*System {
+	return []*System{
+		testSystem(1, "Alpha", 0, 0, 0),
+		testSystem(2, "Beta", 1, 0, 0),
+		testSystem(3, "Gamma", 2, 0, 0),
+		testSystem(4, "Delta", 3, 0, 0),
+		testSystem(5, "Far", 50, 50, 50),
+	}
+}
+
+// newHarness starts a game over the given systems. If no systems are given,
+// the default test galaxy is used. The game is never run; it only advances
+// when stepped.
+func newHarness(t *testing.T, systems ...*System) *harness {
+	if len(systems) == 0 {
+		systems = defaultTestGalaxy()
+	}
+	g := newGame(1, newManualClock(time.Unix(0, 0)), defaultRules(), func(rng *rand.Rand, rules Rules) *Galaxy {
+		return newGalaxy(systems, rng, rules)
+	})
+	g.started = true
+	return &harness{t: t, game: g, systems: systems}
+}
+
+// Restore brings the game back from a snapshot of it, as the server does when
+// it's restarted, and returns a harness for the restored game. The original
+// game is left as it was. The snapshot is stored as JSON on the way, and the
+// restored game gets a galaxy of its own.
+func (h *harness) Restore() *harness {
+	h.t.Helper()
+	data, err := json.Marshal(h.game.Snapshot())
+	if err != nil {
+		h.t.Fatalf("unable to encode snapshot: %v", err)
+	}
+	var snap gameSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		h.t.Fatalf("unable to decode snapshot: %v", err)
+	}
+	clock := newManualClock(h.game.clock.Now())
+	g, err := restoreGameWith(&snap, clock, func(rng *rand.Rand, rules Rules) *Galaxy {
+		systems := make([]*System, len(h.systems))
+		for i, s := range h.systems {
+			systems[i] = &System{id: s.id, name: s.name, x: s.x, y: s.y, z: s.z, planets: s.planets}
+		}
+		return newGalaxy(systems, rng, rules)
+	})
+	if err != nil {
+		h.t.Fatalf("unable to restore game: %v", err)
+	}
+	return &harness{t: h.t, game: g, systems: h.systems}
+}
+
+// Step advances the game by n frames.
+func (h *harness) Step(n int) { h.game.Step(n) }
+
+// StepFor advances the game by however many frames make up the given
+// duration.
+func (h *harness) StepFor(d time.Duration) { h.game.Step(int(h.game.rules.frames(d))) }
+
+// System fetches a system from the game's galaxy by id.
+func (h *harness) System(id int) *System {
+	sys := h.game.galaxy.GetSystemByID(id)
+	if sys == nil {
+		h.t.Fatalf("no such system: %d", id)
+	}
+	return sys
+}
+
+// Join adds a player to the game, idle on the given system.
+func (h *harness) Join(name string, system int) *client {
+	h.t.Helper()
+	cl := newClient(h.t, name, newConnection)
+	cl.conn.profile = &Profile{name: name}
+	cl.conn.game = h.game
+	sys := h.System(system)
+	h.game.Submit(queryMessage(func(g *Game) {
+		g.Join(cl.conn)
+		cl.conn.SetState(Idle(sys))
+	}))
+	h.Step(1)
+	return cl
+}
+
+// client is the far end of a player's connection. Everything the server
+// writes to the player is collected so that it can be checked by a test.
+type client struct {
+	t    *testing.T
+	name string
+	conn *Connection // nil if the server side is handled by handleConnection
+	sock net.Conn
+
+	sync.Mutex
+	buf bytes.Buffer
+}
+
+// newClient connects a client to a connection created by the given function,
+// over an in-memory pipe.
+func newClient(t *testing.T, name string, connect func(net.Conn) *Connection) *client {
+	server, sock := net.Pipe()
+	cl := &client{t: t, name: name, sock: sock}
+	go cl.read()
+	cl.conn = connect(server)
+	t.Cleanup(func() {
+		sock.Close()
+		server.Close()
+	})
+	return cl
+}
+
+func (cl *client) read() {
+	b := make([]byte, 4096)
+	for {
+		n, err := cl.sock.Read(b)
+		cl.Lock()
+		cl.buf.Write(b[:n])
+		cl.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Write sends raw input to the server, as if typed by the player.
+func (cl *client) Write(s string) {
+	cl.t.Helper()
+	if _, err := cl.sock.Write([]byte(s)); err != nil {
+		cl.t.Fatalf("unable to write to server: %v", err)
+	}
+}
+
+// Send runs a command line as the player, going through the same dispatch
+// as a line read from the player's socket. In-game commands are applied on
+// the next frame.
+func (cl *client) Send(line string) {
+	cl.t.Helper()
+	if cl.conn == nil {
+		cl.t.Fatalf("Send needs direct access to the connection; use Write")
+	}
+	parts := parseLine(line)
+	if len(parts) == 0 {
+		cl.t.Fatalf("empty command line")
+	}
+	cl.conn.dispatch(parts)
+}
+
+// Output is everything the client has received so far.
+func (cl *client) Output() string {
+	cl.Lock()
+	defer cl.Unlock()
+	return cl.buf.String()
+}
+
+// Reset discards everything the client has received so far.
+func (cl *client) Reset() {
+	cl.Lock()
+	defer cl.Unlock()
+	cl.buf.Reset()
+}
+
+// Expect waits for the client to receive some text, failing the test if it
+// doesn't arrive in time.
+func (cl *client) Expect(text string) {
+	cl.t.Helper()
+	deadline := time.Now().Add(expectTimeout)
+	for time.Now().Before(deadline) {
+		if strings.Contains(cl.Output(), text) {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cl.t.Fatalf("%s never received %q. received:\n%s", cl.name, text, cl.Output())
+}
+
+// Refute checks that the client has not received some text. Since output is
+// delivered asynchronously, Refute waits briefly for any output in flight.
+func (cl *client) Refute(text string) {
+	cl.t.Helper()
+	time.Sleep(20 * time.Millisecond)
+	if strings.Contains(cl.Output(), text) {
+		cl.t.Fatalf("%s received unexpected %q. received:\n%s", cl.name, text, cl.Output())
+	}
+}
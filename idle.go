@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"time"
 )
 
 type IdleState struct {
@@ -15,21 +14,27 @@ func Idle(sys *System) ConnectionState {
 	i := &IdleState{System: sys}
 	i.CommandSuite = CommandSet{
 		balCommand,
+		intelCommand,
 		playersCommand,
 		BroadcastCommand(sys),
 		NearbyCommand(sys),
 		Command{
-			name:    "goto",
-			summary: "travel between star systems",
-			arity:   1,
-			handler: i.travelTo,
+			name:     "goto",
+			summary:  "travel between star systems",
+			usage:    "goto [system-name or system-id]",
+			help:     systemNameHelp,
+			arity:    1,
+			variadic: true,
+			handler:  i.travelTo,
 		},
 		Command{
-			name:    "bomb",
-			summary: "bomb another star system",
-			arity:   1,
-			usage:   "bomb [system-name or system-id]",
-			handler: i.bomb,
+			name:     "bomb",
+			summary:  "bomb another star system",
+			usage:    "bomb [system-name or system-id]",
+			help:     systemNameHelp,
+			arity:    1,
+			variadic: true,
+			handler:  i.bomb,
 		},
 		Command{
 			name:    "mine",
@@ -65,12 +70,11 @@ func (i *IdleState) Tick(c *Connection, frame int64) ConnectionState {
 }
 
 func (i *IdleState) travelTo(c *Connection, args ...string) {
-	dest := c.game.galaxy.GetSystem(args[0])
+	dest := c.resolveSystem("goto", args)
 	if dest == nil {
-		c.Printf("no such system: %s", args[0])
 		return
 	}
-	c.SetState(NewTravel(c, i.System, dest))
+	c.SetState(newTravelState(&c.game.rules, i.System, dest))
 }
 
 func (i *IdleState) bomb(c *Connection, args ...string) {
@@ -78,19 +82,18 @@ func (i *IdleState) bomb(c *Connection, args ...string) {
 		c.Printf("Cannot send bomb: no bombs left!  Build more bombs!\n")
 		return
 	}
-	if time.Since(c.lastBomb) < 5*time.Second {
-		c.Printf("Cannot send bomb: bombs are reloading\n")
+	if !c.CanBomb() {
+		c.Printf("Cannot send bomb: bombs are reloading. Ready in %v\n", c.NextBomb())
 		return
 	}
 
-	target := c.game.galaxy.GetSystem(args[0])
+	target := c.resolveSystem("bomb", args)
 	if target == nil {
-		c.Printf("Cannot send bomb: no such system: %v\n", args[0])
 		return
 	}
 
 	c.bombs -= 1
-	c.lastBomb = time.Now()
+	c.RecordBomb()
 	bomb := NewBomb(c, i.System, target)
 	c.game.Register(bomb)
 }
@@ -100,11 +103,12 @@ func (i *IdleState) mine(c *Connection, args ...string) {
 }
 
 func (i *IdleState) scan(c *Connection, args ...string) {
-	if time.Since(c.lastScan) < 1*time.Minute {
+	if !c.CanScan() {
+		c.Printf("Cannot scan: scanner is recharging. Ready in %v\n", c.NextScan())
 		return
 	}
-	c.Printf("Scanning the galaxy for signs of life...\n")
-	c.game.Register(NewScan(i.System, c.game.galaxy.Neighborhood(i.System)))
+	c.RecordScan()
+	c.game.Publish(i.System, scanPing{})
 }
 
 // "make" is already a keyword
@@ -115,8 +119,8 @@ func (i *IdleState) maek(c *Connection, args ...string) {
 	}
 	switch args[0] {
 	case "bomb":
-		if c.money < options.bombCost {
-			c.Printf("Not enough money!  Bombs costs %v but you only have %v space duckets.  Mine more space duckets!\n", options.bombCost, c.money)
+		if c.money < c.game.rules.BombCost {
+			c.Printf("Not enough money!  Bombs costs %v but you only have %v space duckets.  Mine more space duckets!\n", c.game.rules.BombCost, c.money)
 			return
 		}
 		c.SetState(MakeBomb(i.System))
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// intelReport is what a player knows about a single star system. Since all
+// knowledge travels at the speed of light, every report is stale: it
+// describes the system as it was on the frame that the light carrying the
+// information left it.
+type intelReport struct {
+	system       *System
+	frame        int64 // frame on which the light carrying this report left the system
+	inhabitants  map[string]bool
+	colonizedBy  string
+	shielded     bool
+	shieldEnergy float64
+	lastBombed   int64 // frame of the most recent bombing observed, 0 if none
+	lastMessage  string
+}
+
+func (r *intelReport) inhabitantNames() []string {
+	names := make([]string, 0, len(r.inhabitants))
+	for name := range r.inhabitants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// noteworthy is true if the report has anything to say beyond the system
+// being empty.
+func (r *intelReport) noteworthy() bool {
+	return len(r.inhabitants) > 0 || r.colonizedBy != "" || r.shielded || r.lastBombed > 0 || r.lastMessage != ""
+}
+
+// intel is a player's knowledge base of the galaxy, keyed by system id.
+type intel map[int]*intelReport
+
+// observe returns the report for a system, to be updated with information
+// that left the system on the given frame. If the player already has more
+// recent information about the system, observe returns nil, since the older
+// light has nothing new to say.
+func (i intel) observe(sys *System, frame int64) *intelReport {
+	r, ok := i[sys.id]
+	if !ok {
+		r = &intelReport{system: sys, inhabitants: make(map[string]bool)}
+		i[sys.id] = r
+	}
+	if frame < r.frame {
+		return nil
+	}
+	r.frame = frame
+	return r
+}
+
+// recordScan replaces everything known about a system with the results of a
+// scan.
+func (i intel) recordScan(res scanResult, frame int64) {
+	r := i.observe(res.system, frame)
+	if r == nil {
+		return
+	}
+	r.inhabitants = make(map[string]bool, len(res.players))
+	for _, name := range res.players {
+		r.inhabitants[name] = true
+	}
+	r.colonizedBy = res.colonizedBy
+	r.shielded = res.shielded
+	r.shieldEnergy = res.shieldEnergy
+}
+
+// learn applies fn to the report on a system for every player at the
+// observing system.
+func learn(at, about *System, frame int64, fn func(*intelReport)) {
+	at.EachConn(func(conn *Connection) {
+		if r := conn.intel.observe(about, frame); r != nil {
+			fn(r)
+		}
+	})
+}
+
+var intelCommand = Command{
+	name:    "intel",
+	summary: "shows what you know about the galaxy",
+	usage:   "intel [system-name or system-id]",
+	help: `
+intel displays everything that you have observed about the star systems in the
+galaxy. Since information travels at the speed of light, everything you know is
+out of date: each report shows the age of the light it was carried by. Intel is
+gathered from scans, broadcasts, and from observing bombings, colonies and
+ships coming and going.
+
+Without an argument, intel summarizes every system you know to have something
+going on. Given the name or id of a system, intel displays the full report for
+that system.
+` + systemNameHelp,
+	handler: func(c *Connection, args ...string) {
+		if len(args) == 0 {
+			c.listIntel()
+			return
+		}
+		sys := c.resolveSystem("intel", args)
+		if sys == nil {
+			return
+		}
+		r, ok := c.intel[sys.id]
+		if !ok {
+			c.Printf("you know nothing about %v\n", sys)
+			return
+		}
+		c.showIntel(r)
+	},
+}
+
+func (c *Connection) listIntel() {
+	if len(c.intel) == 0 {
+		c.Printf("you haven't observed anything yet. Try a scan.\n")
+		return
+	}
+	reports := make([]*intelReport, 0, len(c.intel))
+	for _, r := range c.intel {
+		if r.noteworthy() {
+			reports = append(reports, r)
+		}
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].system.id < reports[j].system.id })
+
+	c.Line()
+	c.Printf("%-4s %-20s %-10s %-20s %s\n", "id", "name", "age", "colonized by", "inhabitants")
+	c.Line()
+	for _, r := range reports {
+		age := c.game.rules.duration(c.game.frame - r.frame)
+		c.Printf("%-4d %-20s %-10v %-20s %s\n", r.system.id, r.system.name, age, r.colonizedBy, strings.Join(r.inhabitantNames(), ", "))
+	}
+	c.Line()
+	c.Printf("%d other systems were observed to be empty.\n", len(c.intel)-len(reports))
+}
+
+var intelTemplate = template.Must(template.New("intel").Parse(`
+Intel on {{.System}}
+--------------------------------------------------------------------------------
+Age:          {{.Age}}
+Distance:     {{.Distance}}
+Inhabitants:  {{.Inhabitants}}
+Colonized by: {{.ColonizedBy}}
+Shielded:     {{.Shielded}}
+{{- if .Shielded}}
+Shield:       {{.ShieldEnergy}}
+{{- end}}
+{{- if .LastBombed}}
+Last bombed:  {{.LastBombed}} ago
+{{- end}}
+{{- if .LastMessage}}
+Last message: {{.LastMessage}}
+{{- end}}
+
+`))
+
+func (c *Connection) showIntel(r *intelReport) {
+	var lastBombed string
+	if r.lastBombed > 0 {
+		lastBombed = c.game.rules.duration(c.game.frame - r.lastBombed).String()
+	}
+	var distance string
+	if here := c.Location(); here != nil {
+		distance = fmt.Sprintf("%.2fpc", here.DistanceTo(r.system))
+	}
+	intelTemplate.Execute(c, struct {
+		System       *System
+		Age          string
+		Distance     string
+		Inhabitants  string
+		ColonizedBy  string
+		Shielded     bool
+		ShieldEnergy float64
+		LastBombed   string
+		LastMessage  string
+	}{
+		System:       r.system,
+		Age:          c.game.rules.duration(c.game.frame - r.frame).String(),
+		Distance:     distance,
+		Inhabitants:  strings.Join(r.inhabitantNames(), ", "),
+		ColonizedBy:  r.colonizedBy,
+		Shielded:     r.shielded,
+		ShieldEnergy: r.shieldEnergy,
+		LastBombed:   lastBombed,
+		LastMessage:  r.lastMessage,
+	})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScanIntel(t *testing.T) {
+	h := newHarness(t)
+	alice := h.Join("alice", 1)
+	bob := h.Join("bob", 3)
+	h.System(3).colonizedBy = bob.conn
+	h.Step(1)
+
+	alice.Send("scan")
+	h.Step(1)
+	sent := h.game.frame
+
+	// Gamma is two parsecs away: the ping takes two seconds to get there and
+	// the echo two more to get back. bob leaves just after the ping reaches
+	// him.
+	trip := h.game.rules.lightFrames(2)
+	h.Step(int(trip))
+	bob.Send("goto 4")
+	h.Step(int(trip) - 1)
+	if r := alice.conn.intel[3]; r != nil && r.colonizedBy != "" {
+		t.Fatalf("alice knew about bob's colony before the echo of her scan got back")
+	}
+	h.Step(1)
+	r := alice.conn.intel[3]
+	if r == nil {
+		t.Fatalf("alice learned nothing from her scan of Gamma")
+	}
+	if r.frame != sent+trip {
+		t.Fatalf("expected alice's intel on Gamma to date from frame %d, when her scan reached it, it dates from %d", sent+trip, r.frame)
+	}
+	if !r.inhabitants["bob"] || r.colonizedBy != "bob" {
+		t.Fatalf("expected alice to know that bob is on Gamma and has colonized it, she knows %v, colonized by %q", r.inhabitantNames(), r.colonizedBy)
+	}
+	alice.Send("intel 3")
+	h.Step(1)
+	alice.Expect("Age:          2.01s")
+	alice.Expect("Distance:     2.00pc")
+	alice.Expect("Inhabitants:  bob")
+	alice.Expect("Colonized by: bob")
+
+	// the light of bob's departure follows a frame behind the echo, and the
+	// report ages from then on
+	h.StepFor(time.Minute)
+	alice.Reset()
+	alice.Send("intel 3")
+	h.Step(1)
+	alice.Expect("Age:          1m2.01s")
+	alice.Refute("Inhabitants:  bob")
+	alice.Expect("Colonized by: bob")
+	if r.inhabitants["bob"] || r.frame != sent+trip+1 {
+		t.Fatalf("expected alice to have seen bob leave Gamma on frame %d, she knows %v as of frame %d", sent+trip+1, r.inhabitantNames(), r.frame)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+)
+
+// kdTree is a spatial index over a set of systems. It's built once, along
+// with the galaxy, and answers questions about which systems are near a point
+// without measuring the distance to every system in the galaxy.
+type kdTree struct {
+	nodes []kdNode
+	root  int
+}
+
+// kdNode holds a single system. The systems in its left subtree lie at or
+// below it along the axis it was split on and those in its right subtree at
+// or above it. lo and hi bound every system in the subtree rooted at the
+// node, including its own.
+type kdNode struct {
+	sys         *System
+	left, right int // indexes into kdTree.nodes, or -1
+	lo, hi      [3]float64
+}
+
+func newKDTree(systems []*System) *kdTree {
+	t := &kdTree{nodes: make([]kdNode, 0, len(systems))}
+	t.root = t.build(append([]*System{}, systems...), 0)
+	return t
+}
+
+// build adds a subtree holding the given systems, which it reorders, and
+// returns the index of its root, or -1 if there are no systems.
+func (t *kdTree) build(systems []*System, depth int) int {
+	if len(systems) == 0 {
+		return -1
+	}
+	axis := depth % 3
+	sort.Slice(systems, func(i, j int) bool {
+		a, b := position(systems[i])[axis], position(systems[j])[axis]
+		if a == b {
+			return systems[i].id < systems[j].id
+		}
+		return a < b
+	})
+	mid := len(systems) / 2
+	p := position(systems[mid])
+	n := kdNode{sys: systems[mid], lo: p, hi: p}
+	n.left = t.build(systems[:mid], depth+1)
+	n.right = t.build(systems[mid+1:], depth+1)
+	for _, child := range []int{n.left, n.right} {
+		if child < 0 {
+			continue
+		}
+		for i := range p {
+			n.lo[i] = math.Min(n.lo[i], t.nodes[child].lo[i])
+			n.hi[i] = math.Max(n.hi[i], t.nodes[child].hi[i])
+		}
+	}
+	t.nodes = append(t.nodes, n)
+	return len(t.nodes) - 1
+}
+
+func position(s *System) [3]float64 { return [3]float64{s.x, s.y, s.z} }
+
+// near starts a walk over every system in the tree other than the given one,
+// in order of distance from it.
+func (t *kdTree) near(sys *System) *kdIter {
+	it := &kdIter{tree: t, from: sys, queue: kdQueue{tree: t}}
+	if t.root >= 0 {
+		heap.Push(&it.queue, kdItem{node: t.root, dist: t.boxDistance(t.root, sys)})
+	}
+	return it
+}
+
+// eachWithin calls fn for every system in the tree, the given one included,
+// that's no more than radius parsecs away from it, in no particular order.
+func (t *kdTree) eachWithin(sys *System, radius float64, fn func(other *System, dist float64)) {
+	var visit func(node int)
+	visit = func(node int) {
+		if node < 0 || t.boxDistance(node, sys) > radius {
+			return
+		}
+		n := &t.nodes[node]
+		if d := sys.DistanceTo(n.sys); d <= radius {
+			fn(n.sys, d)
+		}
+		visit(n.left)
+		visit(n.right)
+	}
+	visit(t.root)
+}
+
+// boxDistance is the shortest possible distance from the system to anything
+// in the subtree rooted at the given node.
+func (t *kdTree) boxDistance(node int, sys *System) float64 {
+	n := &t.nodes[node]
+	p := position(sys)
+	var sum float64
+	for i := range p {
+		switch {
+		case p[i] < n.lo[i]:
+			sum += sq(n.lo[i] - p[i])
+		case p[i] > n.hi[i]:
+			sum += sq(p[i] - n.hi[i])
+		}
+	}
+	return math.Sqrt(sum)
+}
+
+// kdIter walks the systems of a kdTree in order of distance, nearest first,
+// breaking ties by id so that the order is always the same. Subtrees are
+// only opened once nothing outside them can be nearer, so finding the first
+// few systems is cheap no matter how large the tree is.
+type kdIter struct {
+	tree  *kdTree
+	from  *System
+	queue kdQueue
+}
+
+// peek gives the nearest system that hasn't been popped yet. ok is false
+// once every system has been visited.
+func (it *kdIter) peek() (n Neighbor, ok bool) {
+	for it.queue.Len() > 0 {
+		top := it.queue.items[0]
+		node := &it.tree.nodes[top.node]
+		if top.leaf {
+			if node.sys == it.from {
+				heap.Pop(&it.queue)
+				continue
+			}
+			return Neighbor{id: node.sys.id, distance: top.dist}, true
+		}
+		heap.Pop(&it.queue)
+		heap.Push(&it.queue, kdItem{node: top.node, leaf: true, dist: it.from.DistanceTo(node.sys)})
+		for _, child := range []int{node.left, node.right} {
+			if child >= 0 {
+				heap.Push(&it.queue, kdItem{node: child, dist: it.tree.boxDistance(child, it.from)})
+			}
+		}
+	}
+	return Neighbor{}, false
+}
+
+// pop moves past the system returned by peek.
+func (it *kdIter) pop() {
+	if _, ok := it.peek(); ok {
+		heap.Pop(&it.queue)
+	}
+}
+
+// rest lists every system that hasn't been popped yet, nearest first,
+// without moving the walk along.
+func (it *kdIter) rest() Neighborhood {
+	walk := &kdIter{tree: it.tree, from: it.from, queue: kdQueue{tree: it.tree}}
+	walk.queue.items = append([]kdItem{}, it.queue.items...)
+	var rest Neighborhood
+	for n, ok := walk.peek(); ok; n, ok = walk.peek() {
+		rest = append(rest, n)
+		walk.pop()
+	}
+	return rest
+}
+
+// kdItem is either a whole subtree, at the shortest distance anything in it
+// could be, or, if leaf is set, just the system at its root.
+type kdItem struct {
+	node int
+	leaf bool
+	dist float64
+}
+
+// kdQueue is a heap of kdItems. On equal distances subtrees come first, so
+// that every system at a given distance is known before any of them is
+// visited and they can be visited in order of id.
+type kdQueue struct {
+	tree  *kdTree
+	items []kdItem
+}
+
+func (q kdQueue) Len() int      { return len(q.items) }
+func (q kdQueue) Swap(i, j int) { q.items[i], q.items[j] = q.items[j], q.items[i] }
+
+func (q kdQueue) Less(i, j int) bool {
+	a, b := q.items[i], q.items[j]
+	if a.dist != b.dist {
+		return a.dist < b.dist
+	}
+	if a.leaf != b.leaf {
+		return !a.leaf
+	}
+	return q.tree.nodes[a.node].sys.id < q.tree.nodes[b.node].sys.id
+}
+
+func (q *kdQueue) Push(x interface{}) { q.items = append(q.items, x.(kdItem)) }
+
+func (q *kdQueue) Pop() interface{} {
+	last := q.items[len(q.items)-1]
+	q.items = q.items[:len(q.items)-1]
+	return last
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// randomSystems scatters n systems through a cube, some of them on top of
+// each other so that ties in distance get exercised.
+func randomSystems(rng *rand.Rand, n int) []*System {
+	systems := make([]*System, n)
+	for i := range systems {
+		systems[i] = testSystem(i+1, "", float64(rng.Intn(40)), float64(rng.Intn(40)), float64(rng.Intn(40)))
+	}
+	return systems
+}
+
+// bruteNeighborhood measures the distance from sys to every other system.
+func bruteNeighborhood(systems []*System, sys *System) Neighborhood {
+	var neighbors Neighborhood
+	for _, other := range systems {
+		if other != sys {
+			neighbors = append(neighbors, Neighbor{id: other.id, distance: sys.DistanceTo(other)})
+		}
+	}
+	sort.Sort(neighbors)
+	return neighbors
+}
+
+func sameNeighbors(t *testing.T, what string, got, want Neighborhood) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s: expected %d neighbors, got %d", what, len(want), len(got))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("%s: neighbor %d should be %v, got %v", what, i, want[i], got[i])
+		}
+	}
+}
+
+func TestKDTreeMatchesBruteForce(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	systems := randomSystems(rng, 500)
+	g := newGalaxy(systems, rng, defaultRules())
+	for _, sys := range systems[:50] {
+		all := bruteNeighborhood(systems, sys)
+		sameNeighbors(t, "walk", g.Neighbors(sys).rest(), all)
+		sameNeighbors(t, "nearest", g.Nearest(sys, 25), all[:25])
+
+		var within Neighborhood
+		for _, n := range all {
+			if n.distance <= 10 {
+				within = append(within, n)
+			}
+		}
+		sameNeighbors(t, "within", g.Within(sys, 10), within)
+	}
+}
+
+func TestKDTreeWalk(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	systems := randomSystems(rng, 200)
+	g := newGalaxy(systems, rng, defaultRules())
+	sys := systems[0]
+	all := bruteNeighborhood(systems, sys)
+
+	it := g.Neighbors(sys)
+	for i := 0; i < 10; i++ {
+		it.pop()
+	}
+	sameNeighbors(t, "rest after 10", it.rest(), all[10:])
+	n, ok := it.peek()
+	if !ok || n != all[10] {
+		t.Fatalf("rest moved the walk along: expected %v next, got %v", all[10], n)
+	}
+
+	for i := 10; i < len(all); i++ {
+		it.pop()
+	}
+	if _, ok := it.peek(); ok {
+		t.Fatalf("expected the walk to be over once every system was visited")
+	}
+}
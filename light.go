@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Event is something that happens at a star system that can be observed from
+// other star systems. Knowledge of an event travels outward from its origin at
+// the speed of light; an event is observed at each system in the frame that
+// the light from the event arrives there.
+type Event interface {
+	// Observe is called once for every system that the light from the event
+	// reaches, on the frame that it gets there. from is the system at which
+	// the event took place, at is the system doing the observing, and sent
+	// is the frame on which the event took place.
+	Observe(g *Game, from, at *System, sent int64)
+}
+
+// Publish announces an event that has just taken place at the origin system.
+// The event will be observed by every other system in the galaxy as the light
+// from the event reaches it.
+func (g *Game) Publish(origin *System, e Event) {
+	g.Register(&propagation{
+		origin:       origin,
+		start:        g.frame,
+		event:        e,
+		neighborhood: g.galaxy.Neighbors(origin),
+	})
+}
+
+// Send is like Publish, except that the event is only observed at a single
+// destination. This is used for signals that are aimed at one system in
+// particular, e.g. the echo of a scan.
+func (g *Game) Send(from, to *System, e Event) {
+	g.Register(&propagation{
+		origin:       from,
+		start:        g.frame,
+		event:        e,
+		neighborhood: &Neighborhood{{id: to.id, distance: from.DistanceTo(to)}},
+	})
+}
+
+// propagation is the expanding sphere of light emitted by a single event. It
+// is a GameElement; it lives until the light from its event has reached every
+// system in its neighborhood.
+type propagation struct {
+	origin       *System
+	start        int64 // frame on which the event took place
+	event        Event
+	neighborhood neighbors // systems not yet reached
+}
+
+// neighbors yields systems in order of distance from some origin, nearest
+// first. Galaxy.Neighbors finds them as the light spreads, so that a
+// propagation through a large galaxy doesn't have to sort it up front.
+type neighbors interface {
+	// peek gives the nearest system not yet popped; ok is false once there
+	// are none left.
+	peek() (n Neighbor, ok bool)
+	pop()
+	// rest lists the systems not yet popped, nearest first.
+	rest() Neighborhood
+}
+
+func (p *propagation) Tick(game *Game) {
+	for {
+		next, ok := p.neighborhood.peek()
+		if !ok || p.start+game.rules.lightFrames(next.distance) > game.frame {
+			return
+		}
+		p.neighborhood.pop()
+		if sys := game.galaxy.GetSystemByID(next.id); sys != nil {
+			p.event.Observe(game, p.origin, sys, p.start)
+		}
+	}
+}
+
+func (p *propagation) Dead() bool {
+	_, ok := p.neighborhood.peek()
+	return !ok
+}
+
+func (p *propagation) String() string {
+	return fmt.Sprintf("[propagation origin: %v start: %d event: %v]", p.origin, p.start, p.event)
+}
+
+// arrivalEvent is emitted when a ship arrives at a system.
+type arrivalEvent struct {
+	player string
+}
+
+func (e arrivalEvent) Observe(g *Game, from, at *System, sent int64) {
+	learn(at, from, sent, func(r *intelReport) {
+		r.inhabitants[e.player] = true
+	})
+	at.EachConn(func(conn *Connection) {
+		if conn.Name() != e.player {
+			conn.Emit(observationEvent{
+				Observed: "arrival",
+				System:   *from.ref(),
+				Player:   e.player,
+				Message:  fmt.Sprintf("a ship has been observed arriving at %v", from),
+			})
+		}
+	})
+}
+
+// departureEvent is emitted when a ship leaves a system.
+type departureEvent struct {
+	player string
+}
+
+func (e departureEvent) Observe(g *Game, from, at *System, sent int64) {
+	learn(at, from, sent, func(r *intelReport) {
+		delete(r.inhabitants, e.player)
+	})
+	at.EachConn(func(conn *Connection) {
+		if conn.Name() != e.player {
+			conn.Emit(observationEvent{
+				Observed: "departure",
+				System:   *from.ref(),
+				Player:   e.player,
+				Message:  fmt.Sprintf("a ship has been observed departing from %v", from),
+			})
+		}
+	})
+}
+
+// colonyEvent is emitted when a mining colony is founded on a system.
+type colonyEvent struct {
+	owner string
+}
+
+func (e colonyEvent) Observe(g *Game, from, at *System, sent int64) {
+	learn(at, from, sent, func(r *intelReport) {
+		r.colonizedBy = e.owner
+	})
+	at.EachConn(func(conn *Connection) {
+		conn.Emit(observationEvent{
+			Observed: "colony",
+			System:   *from.ref(),
+			Player:   e.owner,
+			Message:  fmt.Sprintf("a mining colony has been observed being founded on %v", from),
+		})
+	})
+}
+
+// bombingEvent is emitted when a bomb detonates on a system.
+type bombingEvent struct{}
+
+func (e bombingEvent) Observe(g *Game, from, at *System, sent int64) {
+	learn(at, from, sent, func(r *intelReport) {
+		r.lastBombed = sent
+	})
+	bombNotice(at, from)
+}
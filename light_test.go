@@ -0,0 +1,132 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// sighting is one observation of a recordedEvent.
+type sighting struct {
+	from, at string
+	sent     int64
+	frame    int64
+}
+
+// recordedEvent notes down every system that observes it, and when.
+type recordedEvent struct {
+	seen *[]sighting
+}
+
+func (e recordedEvent) Observe(g *Game, from, at *System, sent int64) {
+	*e.seen = append(*e.seen, sighting{from: from.name, at: at.name, sent: sent, frame: g.frame})
+}
+
+func TestPublishArrivesAtLightSpeed(t *testing.T) {
+	h := newHarness(t)
+	h.Step(10)
+	var seen []sighting
+	h.game.Publish(h.System(2), recordedEvent{&seen})
+
+	// Alpha and Gamma are a parsec from Beta, Delta is two, and Far is well
+	// out of reach
+	parsec := h.game.rules.lightFrames(1)
+	h.Step(int(parsec) - 1)
+	if len(seen) != 0 {
+		t.Fatalf("the light from the event got somewhere before it could have: %v", seen)
+	}
+	h.Step(1)
+	want := []sighting{
+		{"Beta", "Alpha", 10, 10 + parsec},
+		{"Beta", "Gamma", 10, 10 + parsec},
+	}
+	if !sameSightings(seen, want) {
+		t.Fatalf("after a parsec's worth of frames, the event was seen by %v, expected %v", seen, want)
+	}
+	h.Step(int(parsec) - 1)
+	if len(seen) != 2 {
+		t.Fatalf("the light from the event reached Delta early: %v", seen)
+	}
+	h.Step(1)
+	want = append(want, sighting{"Beta", "Delta", 10, 10 + 2*parsec})
+	if !sameSightings(seen, want) {
+		t.Fatalf("after two parsecs' worth of frames, the event was seen by %v, expected %v", seen, want)
+	}
+
+	// Beta itself never observes its own event; Far does, eventually
+	far := h.game.rules.lightFrames(h.System(2).DistanceTo(h.System(5)))
+	h.Step(int(far - 2*parsec))
+	want = append(want, sighting{"Beta", "Far", 10, 10 + far})
+	if !sameSightings(seen, want) {
+		t.Fatalf("once the light had crossed the galaxy, the event was seen by %v, expected %v", seen, want)
+	}
+}
+
+func TestSendReachesOnlyItsDestination(t *testing.T) {
+	h := newHarness(t)
+	var seen []sighting
+	h.game.Send(h.System(1), h.System(3), recordedEvent{&seen})
+
+	// the signal passes Beta on the way, but Gamma is the only system to
+	// see it
+	frames := h.game.rules.lightFrames(2)
+	h.Step(int(frames) - 1)
+	if len(seen) != 0 {
+		t.Fatalf("the signal was seen before it could have arrived: %v", seen)
+	}
+	h.Step(1)
+	want := []sighting{{"Alpha", "Gamma", 0, frames}}
+	if !reflect.DeepEqual(seen, want) {
+		t.Fatalf("the signal was seen by %v, expected %v", seen, want)
+	}
+	h.Step(int(h.game.rules.lightFrames(100)))
+	if !reflect.DeepEqual(seen, want) {
+		t.Fatalf("the signal went on to be seen by %v, expected only %v", seen, want)
+	}
+}
+
+func TestBroadcastArrivesAtLightSpeed(t *testing.T) {
+	h := newHarness(t)
+	alice := h.Join("alice", 1)
+	bob := h.Join("bob", 3)
+	carol := h.Join("carol", 5)
+	h.Step(1)
+	bob.Reset()
+	carol.Reset()
+
+	// the broadcast goes out on the next frame
+	alice.Send("broadcast is anybody there")
+	h.Step(1)
+	frames := int(h.game.rules.lightFrames(2))
+	h.Step(frames - 1)
+	bob.Refute("is anybody there")
+	if r := bob.conn.intel[1]; r != nil && r.lastMessage != "" {
+		t.Fatalf("bob heard alice's broadcast before it could have reached him")
+	}
+	h.Step(1)
+	bob.Expect("is anybody there")
+	if r := bob.conn.intel[1]; r == nil || r.lastMessage != "is anybody there" {
+		t.Fatalf("expected bob to know what alice broadcast, he knows %v", r)
+	}
+	carol.Refute("is anybody there")
+}
+
+// sameSightings compares two lists of sightings regardless of the order of
+// the ones made on the same frame.
+func sameSightings(got, want []sighting) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	count := make(map[sighting]int)
+	for _, s := range want {
+		count[s]++
+	}
+	for i, s := range got {
+		if i > 0 && s.frame < got[i-1].frame {
+			return false
+		}
+		if count[s]--; count[s] < 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// link is the network side of a Connection: the player's socket, and the
+// queue of data waiting to be written to it. Outgoing data is written to the
+// socket by a dedicated goroutine, so that a slow client never stalls the game
+// that is writing to it.
+//
+// A link is kept separate from the rest of the Connection so that a player's
+// seat in a game can be handed to a new socket, e.g. when reclaiming a seat in
+// a game that was restored from a snapshot.
+type link struct {
+	net.Conn
+	*bufio.Reader
+	protocol  protocol
+	outbox    chan []byte
+	closed    chan struct{}
+	done      chan struct{} // closed once the write loop has exited
+	closeOnce sync.Once
+}
+
+// newLink starts a link on a socket. A link with a nil socket is detached:
+// anything written to it is discarded.
+func newLink(conn net.Conn) *link {
+	l := &link{
+		Conn:   conn,
+		outbox: make(chan []byte, 512),
+		closed: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if conn != nil {
+		l.Reader = bufio.NewReader(conn)
+	}
+	go l.writeLoop()
+	return l
+}
+
+func (l *link) detached() bool { return l.Conn == nil }
+
+func (l *link) writeLoop() {
+	defer close(l.done)
+	for {
+		select {
+		case b := <-l.outbox:
+			if l.detached() {
+				continue
+			}
+			if _, err := l.Conn.Write(b); err != nil {
+				log_error("unable to write to %v: %v", l.RemoteAddr(), err)
+				go l.close()
+				return
+			}
+		case <-l.closed:
+			l.flush()
+			return
+		}
+	}
+}
+
+// write queues data to be written to the socket. write is safe to call from
+// any goroutine.
+func (l *link) write(b []byte) (int, error) {
+	buf := make([]byte, len(b))
+	copy(buf, b)
+	select {
+	case l.outbox <- buf:
+		return len(b), nil
+	case <-l.closed:
+		return 0, io.ErrClosedPipe
+	}
+}
+
+// close hangs up the socket once the write loop has flushed the outbox. A
+// client that won't accept its writes is given a second before it's cut off.
+func (l *link) close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.closed)
+		select {
+		case <-l.done:
+		case <-time.After(time.Second):
+		}
+		if l.Conn != nil {
+			err = l.Conn.Close()
+		}
+	})
+	return err
+}
+
+// flush writes out whatever is still sitting in the outbox, so that a
+// farewell message isn't lost when the player is disconnected.
+func (l *link) flush() {
+	for {
+		select {
+		case b := <-l.outbox:
+			if l.detached() {
+				return
+			}
+			l.Conn.SetWriteDeadline(time.Now().Add(time.Second))
+			if _, err := l.Conn.Write(b); err != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"strings"
 	"time"
 )
@@ -48,6 +50,10 @@ func EnterLobby() ConnectionState {
 			newGameCommand,
 			joinGameCommand,
 			listGamesCommand,
+			rulesCommand,
+			passwdCommand,
+			renameCommand,
+			deleteAccountCommand,
 		},
 	}
 }
@@ -55,41 +61,84 @@ func EnterLobby() ConnectionState {
 func (st *LobbyState) String() string { return "Lobby" }
 
 func (st *LobbyState) Enter(c *Connection) {
-	c.Printf(strings.TrimSpace(banner))
-	time.Sleep(1 * time.Second)
+	c.negotiate()
+	if c.protocol == textProtocol {
+		c.Printf(strings.TrimSpace(banner))
+		time.Sleep(1 * time.Second)
+	}
 
+	if !c.login() {
+		c.Close()
+		return
+	}
+	if c.game == nil && !c.resumeSeat() {
+		c.ListCommands()
+	}
+}
+
+// login identifies a newly connected player. Players connecting over ssh are
+// identified by their key; everybody else is asked for their name and password.
+func (c *Connection) login() bool {
+	if k, ok := c.Conn.(keyHolder); ok {
+		return c.keyLogin(k.publicKey())
+	}
 	for {
-		c.Printf("\n\nWhat is your name, adventurer?\n")
-		name, err := c.ReadString('\n')
-		if err == nil {
-			name = strings.TrimSpace(name)
-		} else {
+		c.Emit(promptEvent{Prompt: "name", Text: "What is your name, adventurer?"})
+		name, err := c.readLine()
+		if err != nil {
 			log_error("player failed to connect: %v", err)
-			return
+			return false
 		}
 
+		if token, ok := resumeToken(name); ok {
+			if c.resumeSession(token) {
+				return true
+			}
+			continue
+		}
 		if !ValidName(name) {
 			c.Printf("that name is illegal.\n")
 			continue
 		}
-		log_info("player connected: %v", name)
 		profile, err := loadProfile(name)
-		if err != nil {
-			log_error("could not read profile: %v", err)
+		switch {
+		case err != nil:
 			profile = &Profile{name: name}
+			c.Printf("you look new around these parts, %s.\n", profile.name)
+			password, ok := c.choosePassword("Choose a password:")
+			if !ok {
+				return false
+			}
+			if profile.password, err = hashPassword(password); err != nil {
+				log_error("unable to hash password: %v", err)
+				return false
+			}
 			if err := profile.Create(); err != nil {
 				log_error("unable to create profile record: %v", err)
+				c.Printf("that name was just taken by somebody else.\n")
+				continue
 			}
-			c.Printf("you look new around these parts, %s.\n", profile.name)
 			c.Printf(`if you'd like a description of how to play, type the "help" command\n`)
-			c.profile = profile
-		} else {
-			c.profile = profile
+		case profile.password == nil:
+			c.Printf("Welcome back, %s. you'll need a password from now on.\n", profile.name)
+			password, ok := c.choosePassword("Choose a password:")
+			if !ok {
+				return false
+			}
+			if err := profile.SetPassword(password); err != nil {
+				log_error("unable to set password: %v", err)
+				return false
+			}
+		default:
+			if !c.checkPassword(profile) {
+				return false
+			}
 			c.Printf("Welcome back, %s.\n", profile.name)
 		}
-		break
+		log_info("player connected: %v", name)
+		c.profile = profile
+		return true
 	}
-	c.ListCommands()
 }
 
 func (st *LobbyState) Tick(c *Connection, frame int64) ConnectionState { return st }
@@ -104,18 +153,64 @@ game, or a "join" command to join an existing game.
 var newGameCommand = Command{
 	name:     "new",
 	summary:  "starts a new game",
-	arity:    0,
-	variadic: false,
+	usage:    "new [rules] [private] [option=value...]",
+	arity:    1,
+	variadic: true,
+	help: `
+Starts a new game. Every game is played by a set of rules, which decide things
+like how fast ships travel and how much bombs cost. Name a rule set to play by
+it, e.g. "new blitz"; without one, the server's default rule set is used. Use
+the "rules" command to see the rule sets.
+
+To close the game to strangers, add "private": you'll be asked to choose a
+password, which players must give to join. The rules can be adjusted with
+options:
+
+    players=N       the most players that may join the game
+    money=N         how much money each player starts with
+    bombs=N         how many bombs each player starts with
+    size=N          how many systems the galaxy has, taking those nearest its center
+    radius=X        takes only the systems within X parsecs of the galaxy's center
+    center=S        the system, by id or name, at the center of a galaxy cut down by
+                    size or radius. "cluster" finds the densest cluster of systems;
+                    without a center, a random system is used. Names may be cut
+                    short, and quoted if they have spaces: center="HD 113538"
+    shape=S         generates a galaxy of the given shape, instead of using real
+                    stars: disc, spiral, clusters or cube. "catalog" uses real stars
+    stars=N         how many systems a generated galaxy has, up to 20000
+    density=X       systems per cubic parsec, up to 1, in a generated galaxy
+    planets=X       the mean number of planets on a generated system, up to 10
+    seed=N          generates the same galaxy as another game with the same seed
+    frame-rate=N    how many frames are simulated per second, up to 1000
+    wins=V,...      the victories that end the game: economic, military
+
+e.g. "new blitz private players=2 size=40 center=cluster"
+`,
 	handler: func(c *Connection, args ...string) {
+		settings, err := parseGameSettings(args)
+		if err != nil {
+			c.Printf("%v\n", err)
+			return
+		}
+		if settings.private {
+			password, ok := c.choosePassword("Choose a password for the game:")
+			if !ok {
+				return
+			}
+			if settings.password, err = hashPassword(password); err != nil {
+				log_error("unable to hash game password: %v", err)
+				c.Printf("Unable to start a private game.\n")
+				return
+			}
+		}
 		c.Printf("Starting a new game...\n")
-		game := gm.NewGame()
-		log_info("%s Created game: %s", c.profile.name, game.id)
+		game := gm.NewGame(settings)
+		log_info("%s Created game: %s (%s rules)", c.profile.name, game.id, settings.rules.Name)
 		go game.Run()
 		c.game = game
 		c.Printf("Now playing in game: %s\n\n", game.id)
 		c.Line()
-		c.game.Join(c)
-		c.SetState(game.SpawnPlayer())
+		game.Submit(joinMessage{conn: c})
 	},
 	debug: false,
 }
@@ -128,36 +223,81 @@ var joinGameCommand = Command{
 	variadic: false,
 	handler: func(c *Connection, args ...string) {
 		if len(args) == 0 {
-			gm.Lock()
-			defer gm.Unlock()
-			if len(gm.games) == 1 {
-				for _, game := range gm.games {
-					c.game = game
-					log_info("%s Joining game: %s", c.profile.name, c.game.id)
-					c.Printf("You have joined game %s\n", game.id)
-					c.SetState(game.SpawnPlayer())
-					c.game.Join(c)
-					return
-				}
+			games := gm.List()
+			if len(games) == 1 {
+				joinGame(c, games[0])
+				return
 			}
 			c.Printf(strings.TrimLeft(`
 Missing game code! When a player starts a game, they will be given a code to
-identify their game. Use this game to join the other player's game.
+identify their game. Use this game to join the other player's game. If the
+game is private, you'll be asked for its password.
 
 Usage: join [game-code]`, " \n\t"))
 			return
 		}
+		if len(args) > 1 {
+			c.Printf("Usage: join [game-code]\nIf the game is private, you'll be asked for its password.\n")
+			return
+		}
 		id := args[0]
 		game := gm.Get(id)
-		c.game = game
-		log_info("%s Joining game: %s", c.profile.name, c.game.id)
-		c.Printf("You have joined game %s\n", game.id)
-		c.SetState(game.SpawnPlayer())
-		c.game.Join(c)
+		if game == nil {
+			c.Printf("No such game: %s\n", id)
+			return
+		}
+		joinGame(c, game)
 	},
 	debug: false,
 }
 
+// joinGame seats a player in a game, if the game will have them. Players
+// that already have a seat in the game are handed it back. If the game is
+// private, the player is asked for its password, which isn't echoed.
+func joinGame(c *Connection, game *Game) bool {
+	err := admit(c, game, false)
+	if errors.Is(err, errPasswordNeeded) {
+		c.Emit(promptEvent{Prompt: "game-password", Text: fmt.Sprintf("Game %s is private. Password:", game.id)})
+		password, rerr := c.readPassword()
+		if rerr != nil {
+			log_error("player failed to enter a game password: %v", rerr)
+			return false
+		}
+		if !game.unlocks(password) {
+			c.Printf("wrong password for game %s\n", game.id)
+			return false
+		}
+		err = admit(c, game, true)
+	}
+	if err != nil {
+		c.Printf("%v\n", err)
+		return false
+	}
+	log_info("%s Joined game: %s", c.profile.name, game.id)
+	return true
+}
+
+// admit asks a game to seat a player, waiting for its answer. unlocked is
+// whether the player has given the game's password.
+func admit(c *Connection, game *Game, unlocked bool) error {
+	c.game = game
+	reply := make(chan error, 1)
+	if !game.Submit(admitMessage{conn: c, unlocked: unlocked, reply: reply}) {
+		c.game = nil
+		return fmt.Errorf("No such game: %s", game.id)
+	}
+	var err error
+	select {
+	case err = <-reply:
+	case <-game.done:
+		err = fmt.Errorf("game %s is over", game.id)
+	}
+	if err != nil {
+		c.game = nil
+	}
+	return err
+}
+
 var listGamesCommand = Command{
 	name:     "list",
 	summary:  "lists game lobbies that can be joined",
@@ -165,18 +305,19 @@ var listGamesCommand = Command{
 	arity:    0,
 	variadic: false,
 	handler: func(c *Connection, args ...string) {
-		gm.Lock()
-		defer gm.Unlock()
-
 		c.Line()
 		c.Printf("%-8s %-20s\n", "Game", "Player")
 		c.Line()
 
-		for id, game := range gm.games {
-			c.Printf("%-8s %-20s\n", id, "")
-			for conn, _ := range game.connections {
-				if conn.profile != nil {
-					c.Printf("%-8s %-20s\n", "", conn.profile.name)
+		for _, game := range gm.List() {
+			summary, ok := game.Summary()
+			if !ok {
+				continue
+			}
+			c.Printf("%-8s %s\n", game.id, summary.describe(game.rules))
+			for _, name := range summary.players {
+				if name != "" {
+					c.Printf("%-8s %-20s\n", "", name)
 				}
 			}
 			c.Printf("--------------------\n")
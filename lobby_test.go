@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+// uniqueName makes a player name that hasn't been used by any other test
+func uniqueName(prefix string) string {
+	nameCounter += 1
+	return fmt.Sprintf("%s%d", prefix, nameCounter)
+}
+
+var nameCounter int
+
+func TestLobbyFlow(t *testing.T) {
+	aliceName, bobName := uniqueName("alice"), uniqueName("bob")
+	alice := newClient(t, aliceName, func(sock net.Conn) *Connection {
+		go handleConnection(sock)
+		return nil
+	})
+	alice.Expect("What is your name, adventurer?")
+
+	alice.Write("no spaces allowed\n")
+	alice.Expect("that name is illegal")
+
+	alice.Write(aliceName + "\n")
+	alice.Expect("you look new around these parts, " + aliceName)
+	alice.Expect("Choose a password:")
+	alice.Write("hunter2\n")
+	alice.Expect("Type it again to confirm:")
+	alice.Write("hunter3\n")
+	alice.Expect("those passwords don't match")
+	alice.Write("hunter2\n")
+	alice.Write("hunter2\n")
+	alice.Expect("Available Commands in state: Lobby")
+
+	alice.Write("new\n")
+	alice.Expect("Now playing in game: ")
+	out := alice.Output()
+	start := strings.Index(out, "Now playing in game: ") + len("Now playing in game: ")
+	code := out[start : start+4]
+	game := gm.Get(code)
+	if game == nil {
+		t.Fatalf("game %q was not registered with the game manager", code)
+	}
+	alice.Expect("You're in the staging room of game " + code)
+
+	bob := newClient(t, bobName, func(sock net.Conn) *Connection {
+		go handleConnection(sock)
+		return nil
+	})
+	bob.Expect("What is your name, adventurer?")
+	bob.Write(bobName + "\n")
+	bob.Write("swordfish\n")
+	bob.Write("swordfish\n")
+	bob.Expect("Available Commands in state: Lobby")
+
+	bob.Write("list\n")
+	bob.Expect(code)
+	bob.Expect(aliceName)
+
+	bob.Write("join " + code + "\n")
+	bob.Expect("You have joined game " + code)
+	alice.Expect("Player " + bobName + " has joined the game")
+
+	bob.Write("status\n")
+	bob.Expect("Current Game:  " + code)
+	bob.Expect("Waiting for game " + code + " to start")
+
+	bob.Write("start\n")
+	bob.Expect("Only the host, " + aliceName + ", can start the game")
+	alice.Write("start\n")
+	alice.Expect("Still waiting for: " + bobName)
+	bob.Write("ready\n")
+	alice.Expect(bobName + " is ready")
+	alice.Write("start\n")
+	alice.Expect("The game has begun!")
+	alice.Expect("you are in the system")
+	bob.Expect("The game has begun!")
+	bob.Expect("you are in the system")
+}
+
+func TestLobbyWelcomesReturningPlayers(t *testing.T) {
+	name := uniqueName("carol")
+	for i := 0; i < 2; i++ {
+		carol := newClient(t, name, func(sock net.Conn) *Connection {
+			go handleConnection(sock)
+			return nil
+		})
+		carol.Expect("What is your name, adventurer?")
+		carol.Write(name + "\n")
+		if i == 0 {
+			carol.Expect("you look new around these parts")
+			carol.Write("opensesame\n")
+			carol.Write("opensesame\n")
+		} else {
+			carol.Expect("Password:")
+			carol.Write("opensesame\n")
+			carol.Expect("Welcome back, " + name)
+		}
+		carol.sock.Close()
+	}
+}
+
+// login connects a client through the lobby, registering the name if needed.
+func login(t *testing.T, name, password string) *client {
+	cl := newClient(t, name, func(sock net.Conn) *Connection {
+		go handleConnection(sock)
+		return nil
+	})
+	cl.Expect("What is your name, adventurer?")
+	cl.Write(name + "\n")
+	if _, err := loadProfile(name); err != nil {
+		cl.Write(password + "\n")
+	}
+	cl.Write(password + "\n")
+	cl.Expect("Available Commands in state: Lobby")
+	cl.Reset()
+	return cl
+}
+
+func TestLobbyRejectsWrongPasswords(t *testing.T) {
+	name := uniqueName("dave")
+	login(t, name, "correct").sock.Close()
+
+	mallory := newClient(t, name, func(sock net.Conn) *Connection {
+		go handleConnection(sock)
+		return nil
+	})
+	mallory.Expect("What is your name, adventurer?")
+	mallory.Write(name + "\n")
+	for i := 0; i < maxPasswordAttempts; i++ {
+		mallory.Expect("Password:")
+		mallory.Write("incorrect\n")
+	}
+	mallory.Expect("too many failed attempts")
+	mallory.Refute("Welcome back")
+	if _, err := mallory.sock.Write([]byte("list\n")); err == nil {
+		t.Fatalf("connection was still open after too many failed logins")
+	}
+}
+
+func TestLegacyProfilesChooseAPassword(t *testing.T) {
+	name := uniqueName("erin")
+	if _, err := db.Exec(`insert into profiles (name) values (?)`, name); err != nil {
+		t.Fatalf("unable to create legacy profile: %v", err)
+	}
+	erin := newClient(t, name, func(sock net.Conn) *Connection {
+		go handleConnection(sock)
+		return nil
+	})
+	erin.Expect("What is your name, adventurer?")
+	erin.Write(name + "\n")
+	erin.Expect("you'll need a password from now on")
+	erin.Write("newpass\n")
+	erin.Write("newpass\n")
+	erin.Expect("Available Commands in state: Lobby")
+
+	p, err := loadProfile(name)
+	if err != nil {
+		t.Fatalf("unable to load profile: %v", err)
+	}
+	if !p.CheckPassword("newpass") {
+		t.Fatalf("legacy profile did not get the new password")
+	}
+}
+
+func TestAccountCommands(t *testing.T) {
+	name, newName := uniqueName("frank"), uniqueName("francis")
+	frank := login(t, name, "first")
+
+	// passwords are asked for, rather than typed as arguments, so that they
+	// aren't echoed
+	frank.Write("passwd\n")
+	frank.Expect("Password:")
+	frank.Write("wrong\n")
+	frank.Expect("wrong password")
+	frank.Write("passwd\n")
+	frank.Write("first\n")
+	frank.Expect("Choose a password:")
+	frank.Write("second\n")
+	frank.Write("second\n")
+	frank.Expect("your password has been changed")
+
+	frank.Reset()
+	frank.Write("rename " + newName + "\n")
+	frank.Expect("Password:")
+	frank.Write("first\n")
+	frank.Expect("wrong password")
+	frank.Write("rename " + newName + "\n")
+	frank.Write("second\n")
+	frank.Expect("you are now known as " + newName)
+	if _, err := loadProfile(name); err == nil {
+		t.Fatalf("old name %s still has a profile", name)
+	}
+
+	frank.Write("delete\n")
+	frank.Write("second\n")
+	frank.Expect("your account has been deleted")
+	if _, err := loadProfile(newName); err == nil {
+		t.Fatalf("profile %s was not deleted", newName)
+	}
+}
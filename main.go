@@ -1,41 +1,54 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
-	"math/rand"
 	"net"
 	"os"
 	"time"
 )
 
 var options struct {
-	bombCost       int
-	bombSpeed      float64
-	debug          bool
-	economic       int
-	frameLength    time.Duration
-	colonyCost     int
-	frameRate      int
-	lightSpeed     float64 // the distance that light travels in one tick
-	makeBombTime   time.Duration
-	makeColonyTime time.Duration
-	makeShieldTime time.Duration
-	moneyMean      float64
-	moneySigma     float64
-	playerSpeed    float64
-	respawnFrames  int64
-	respawnTime    time.Duration
-	scanTime       time.Duration
-	speckPath      string
-	startBombs     int
-	startMoney     int
+	bombCost          int
+	bombReloadTime    time.Duration
+	bombSpeed         float64
+	catalog           string
+	catalogFormat     string
+	debug             bool
+	config            string
+	economic          int
+	colonyCost        int
+	frameRate         int
+	gameLogDir        string
+	lightSpeed        float64 // the distance that light travels in one tick
+	makeBombTime      time.Duration
+	makeColonyTime    time.Duration
+	makeShieldTime    time.Duration
+	moneyMean         float64
+	moneySigma        float64
+	playerSpeed       float64
+	respawnTime       time.Duration
+	resumeGrace       time.Duration
+	rules             string
+	scanTime          time.Duration
+	shutdownCountdown time.Duration
+	snapshotInterval  time.Duration
+	spawnDistance     float64
+	startCountdown    time.Duration
+	sshAddr           string
+	sshHostKey        string
+	startBombs        int
+	startMoney        int
+	wsAddr            string
 }
 
+// The loggers are ready from the start, since reading the config can already
+// have something to say, e.g. about the star catalogs its rule sets name.
 var (
-	info_log  *log.Logger
-	error_log *log.Logger
+	info_log  = log.New(os.Stdout, "[INFO] ", 0)
+	error_log = log.New(os.Stderr, "[ERROR] ", 0)
 )
 
 func log_error(template string, args ...interface{}) {
@@ -57,50 +70,78 @@ func bail(status int, template string, args ...interface{}) {
 
 func handleConnection(sock net.Conn) {
 	conn := NewConnection(sock)
-	defer conn.Close()
-
-	c := make(chan []string)
-	go conn.ReadLines(c)
-
-	for parts := range c {
-		conn.RunCommand(parts[0], parts[1:]...)
+	// the connection's link is handed over to its seat if it reclaims one, and
+	// a seat's link is replaced when it's reclaimed or detached, so hang on to
+	// the link that belongs to this socket.
+	l := conn.link
+	defer func() {
+		log_info("connection closed: %s", conn.Name())
+		l.close()
+	}()
+
+	conn.ReadLines(conn.dispatch)
+	if conn.game != nil {
+		conn.game.Submit(quitMessage{conn: conn, link: l})
 	}
 }
 
-// converts a duration in human time to a number of in-game frames
-func durToFrames(dur time.Duration) int64 {
-	return int64(dur / options.frameLength)
-}
-
-func framesToDur(frames int64) time.Duration {
-	return options.frameLength * time.Duration(frames)
-}
-
 func main() {
 	flag.Parse()
+	if options.config != "" {
+		if err := loadConfig(options.config); err != nil {
+			bail(E_Bad_Config, "%v\n", err)
+		}
+	}
+	if err := checkRuleSets(); err != nil {
+		bail(E_Bad_Config, "%v\n", err)
+	}
 	dbconnect()
-	options.frameLength = time.Second / time.Duration(options.frameRate)
-	options.respawnFrames = durToFrames(options.respawnTime)
+	setupDb()
 
-	rand.Seed(time.Now().UnixNano())
-	info_log = log.New(os.Stdout, "[INFO] ", 0)
-	error_log = log.New(os.Stderr, "[ERROR] ", 0)
+	if flag.Arg(0) == "replay" {
+		if flag.NArg() != 2 {
+			bail(E_Replay_Failed, "usage: exo [options] replay [game-log-path]\n")
+		}
+		if err := replay(flag.Arg(1)); err != nil {
+			bail(E_Replay_Failed, "replay failed: %v\n", err)
+		}
+		return
+	}
+
+	gm.Restore()
+
+	if options.sshAddr != "" {
+		go listenSSH(options.sshAddr)
+	}
+	if options.wsAddr != "" {
+		go listenWebsocket(options.wsAddr)
+	}
 
-	setupDb()
 	addr := ":9220"
 	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		bail(E_No_Port, "unable to start server: %v", err)
 	}
+	addListener(listener)
 	log_info("listening on %s", addr)
+	go acceptPlayers(listener)
+
+	shutdownOnSignal()
+}
 
+// acceptPlayers plays the game with every telnet client that connects, until
+// the listener is closed.
+func acceptPlayers(listener net.Listener) {
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
 			log_error("error accepting connection: %v", err)
 			continue
 		}
-		go handleConnection(conn)
+		go handleConnection(newTelnetConn(conn))
 	}
 }
 
@@ -113,14 +154,28 @@ func init() {
 	flag.Float64Var(&options.moneyMean, "money-mean", 10000, "mean amount of money on a system")
 	flag.Float64Var(&options.moneySigma, "money-sigma", 1500, "standard deviation in money per system")
 	flag.BoolVar(&options.debug, "debug", false, "puts the game in debug mode")
-	flag.StringVar(&options.speckPath, "speck-path", "./expl.speck", "path to exoplanet speck file")
+	flag.StringVar(&options.catalog, "catalog", "./expl.speck", "path to the star catalog that galaxies are built from")
+	flag.StringVar(&options.catalog, "speck-path", "./expl.speck", "deprecated: use -catalog")
+	flag.StringVar(&options.catalogFormat, "catalog-format", "", "format of the star catalog: speck, csv or json. taken from the file extension if empty")
+	flag.StringVar(&options.gameLogDir, "game-log-dir", "./game-logs", "directory in which to record game logs")
 	flag.DurationVar(&options.respawnTime, "respawn-time", 60*time.Second, "time for player respawn")
 	flag.DurationVar(&options.makeBombTime, "bomb-time", 5*time.Second, "time it takes to make a bomb")
 	flag.IntVar(&options.bombCost, "bomb-cost", 500, "price of a bomb")
+	flag.DurationVar(&options.bombReloadTime, "bomb-reload", 5*time.Second, "time it takes to reload the bomb launcher after firing")
 	flag.IntVar(&options.colonyCost, "colony-cost", 2000, "price of a colony")
 	flag.DurationVar(&options.makeColonyTime, "colony-time", 15*time.Second, "time it takes to make a colony")
 	flag.IntVar(&options.startBombs, "start-bombs", 0, "number of bombs a player has at game start")
 	flag.IntVar(&options.startMoney, "start-money", 1000, "amount of money a player has to start")
 	flag.DurationVar(&options.makeShieldTime, "shield-time", 15*time.Second, "time it takes to make a shield")
+	flag.Float64Var(&options.spawnDistance, "spawn-distance", 20, "the closest, in parsecs, that players are placed to each other when the galaxy has room")
 	flag.DurationVar(&options.scanTime, "scan-recharge", 1*time.Minute, "time it takes for scanners to recharge")
+	flag.StringVar(&options.sshAddr, "ssh-addr", "", "address on which to serve ssh clients, e.g. :9222. ssh is disabled if empty")
+	flag.StringVar(&options.sshHostKey, "ssh-host-key", "./ssh_host_key", "path to the ssh host key. a key is generated if the file doesn't exist")
+	flag.StringVar(&options.wsAddr, "ws-addr", "", "address on which to serve websocket clients, e.g. :9221. websockets are disabled if empty")
+	flag.DurationVar(&options.resumeGrace, "resume-grace", 2*time.Minute, "how long a disconnected player's seat is kept for them to resume")
+	flag.DurationVar(&options.shutdownCountdown, "shutdown-countdown", 30*time.Second, "how long players are warned before the server shuts down")
+	flag.StringVar(&options.config, "config", "", "path to a JSON config file setting server defaults and rule sets")
+	flag.StringVar(&options.rules, "rules", "classic", "rule set used by games started without naming one")
+	flag.DurationVar(&options.startCountdown, "start-countdown", 10*time.Second, "how long the countdown to the start of a game lasts")
+	flag.DurationVar(&options.snapshotInterval, "snapshot-interval", 1*time.Minute, "how often running games are saved to the database")
 }
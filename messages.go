@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+)
+
+// GameMessage is a unit of work handed to a Game from outside of its run
+// loop. Messages are queued on the game's inbox and applied in order on the
+// game's own goroutine at the start of each frame, so that the handlers never
+// have to worry about game state being mutated out from under them.
+type GameMessage interface {
+	Apply(*Game)
+}
+
+// commandMessage carries a command typed by a player that is currently in a
+// game.
+type commandMessage struct {
+	conn *Connection
+	name string
+	args []string
+}
+
+func (m commandMessage) Apply(g *Game) {
+	conn := g.resolve(m.conn)
+	if !g.connections[conn] {
+		return
+	}
+	g.record(logEntry{Type: "command", Player: conn.Name(), Command: m.name, Args: m.args})
+	conn.RunCommand(m.name, m.args...)
+}
+
+// joinMessage adds a player to a game and spawns their ship. If the game
+// already has a seat for a player of the same name, the player reclaims that
+// seat instead.
+type joinMessage struct {
+	conn *Connection
+}
+
+func (m joinMessage) Apply(g *Game) {
+	if seat := g.seatOf(m.conn.Name()); seat != nil {
+		g.record(logEntry{Type: "reclaim", Player: m.conn.Name()})
+		g.Reclaim(seat, m.conn)
+		return
+	}
+	g.record(logEntry{Type: "join", Player: m.conn.Name()})
+	g.Join(m.conn)
+	if !g.started {
+		g.cancelCountdown(fmt.Sprintf("%s has joined", m.conn.Name()))
+		m.conn.SetState(Staging())
+		return
+	}
+	m.conn.SetState(g.SpawnPlayer(m.conn))
+}
+
+// quitMessage tells a game that a player's socket has gone away. The player's
+// seat is kept for them for a while, in case they come back.
+type quitMessage struct {
+	conn *Connection
+	link *link // the socket that went away
+}
+
+func (m quitMessage) Apply(g *Game) {
+	conn := g.resolve(m.conn)
+	delete(g.aliases, m.conn)
+	if !g.connections[conn] {
+		return
+	}
+	if conn.link != m.link {
+		// the seat has already been reclaimed by a newer connection
+		return
+	}
+	if !g.started {
+		// seats aren't kept in a game that hasn't begun
+		g.record(logEntry{Type: "quit", Player: conn.Name()})
+		g.leaveStaging(conn)
+		return
+	}
+	g.record(logEntry{Type: "detach", Player: conn.Name()})
+	g.Detach(conn)
+}
+
+// queryMessage runs an arbitrary function on the game's goroutine. It's used
+// to read game state from outside of the game, e.g. from the lobby.
+type queryMessage func(*Game)
+
+func (m queryMessage) Apply(g *Game) {
+	m(g)
+}
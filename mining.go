@@ -15,6 +15,7 @@ func Mine(sys *System) ConnectionState {
 	m := &MiningState{System: sys}
 	m.CommandSuite = CommandSet{
 		balCommand,
+		intelCommand,
 		playersCommand,
 		BroadcastCommand(sys),
 		NearbyCommand(sys),
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestMiningPayout(t *testing.T) {
+	h := newHarness(t)
+	alice := h.Join("alice", 1)
+	sys := h.System(1)
+	sys.money = 50
+	start := alice.conn.money
+
+	alice.Send("mine")
+	h.Step(20)
+	if alice.conn.money != start+20 {
+		t.Fatalf("expected alice to have mined 20 space duckets, she has %d", alice.conn.money-start)
+	}
+	if sys.money != 30 {
+		t.Fatalf("expected 30 space duckets to remain on %v, there are %d", sys, sys.money)
+	}
+
+	alice.Send("stop")
+	h.Step(10)
+	if alice.conn.money != start+20 {
+		t.Fatalf("alice kept mining after stopping")
+	}
+	alice.Expect("Mined 20 space duckets total")
+}
+
+func TestMiningExhaustsSystem(t *testing.T) {
+	h := newHarness(t)
+	alice := h.Join("alice", 1)
+	sys := h.System(1)
+	sys.money = 10
+	start := alice.conn.money
+
+	alice.Send("mine")
+	h.Step(20)
+	if alice.conn.money != start+10 {
+		t.Fatalf("expected alice to have mined 10 space duckets, she has %d", alice.conn.money-start)
+	}
+	if sys.money != 0 {
+		t.Fatalf("expected %v to be empty, it has %d", sys, sys.money)
+	}
+	if _, ok := alice.conn.ConnectionState.(*IdleState); !ok {
+		t.Fatalf("expected alice to stop mining, she is %v", alice.conn.ConnectionState)
+	}
+	alice.Expect("all out of space duckets")
+}
+
+func TestEconomicVictory(t *testing.T) {
+	h := newHarness(t)
+	alice := h.Join("alice", 1)
+	alice.conn.money = h.game.rules.Economic - 5
+
+	alice.Send("mine")
+	h.Step(10)
+	if h.game.winner != "alice" || h.game.winMethod != "economic" {
+		t.Fatalf("expected alice to win by economic victory, winner: %q method: %q", h.game.winner, h.game.winMethod)
+	}
+	alice.Expect("player alice has won by economic victory")
+}
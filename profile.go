@@ -1,8 +1,13 @@
 package main
 
 import (
+	"database/sql"
 	"fmt"
 	"regexp"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/ssh"
 )
 
 var namePattern = regexp.MustCompile(`^[[:alpha:]][[:alnum:]-_]{0,19}$`)
@@ -11,39 +16,185 @@ func ValidName(name string) bool {
 	return namePattern.MatchString(name)
 }
 
+// passwordCost is the bcrypt cost used when hashing passwords.
+var passwordCost = bcrypt.DefaultCost
+
 type Profile struct {
-	id   int
-	name string
+	id       int
+	name     string
+	password []byte // bcrypt hash, salt included. nil if no password is set.
+}
+
+// hashPassword salts and hashes a password for storage.
+func hashPassword(password string) ([]byte, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if err != nil {
+		return nil, fmt.Errorf("unable to hash password: %v", err)
+	}
+	return hash, nil
 }
 
 func (p *Profile) Create() error {
-	_, err := db.Exec(`
+	res, err := db.Exec(`
         insert into profiles
-        (name)
+        (name, password)
         values
-        (?)
-    ;`, p.name)
+        (?, ?)
+    ;`, p.name, p.password)
 	if err != nil {
 		return fmt.Errorf("unable to create profile: %v", err)
 	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("unable to read new profile id: %v", err)
+	}
+	p.id = int(id)
+	return nil
+}
+
+// CheckPassword checks a password against the profile's password hash. A
+// profile without a password doesn't match any password.
+func (p *Profile) CheckPassword(password string) bool {
+	if p.password == nil {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword(p.password, []byte(password)) == nil
+}
+
+// SetPassword changes the profile's password.
+func (p *Profile) SetPassword(password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec(`update profiles set password = ? where id = ?`, hash, p.id); err != nil {
+		return fmt.Errorf("unable to update password: %v", err)
+	}
+	p.password = hash
+	return nil
+}
+
+// Rename changes the profile's name.
+func (p *Profile) Rename(name string) error {
+	if _, err := db.Exec(`update profiles set name = ? where id = ?`, name, p.id); err != nil {
+		return fmt.Errorf("unable to rename profile: %v", err)
+	}
+	p.name = name
+	return nil
+}
+
+// Delete removes the profile, along with any keys associated with it.
+func (p *Profile) Delete() error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("unable to delete profile: %v", err)
+	}
+	if _, err := tx.Exec(`delete from profile_keys where profile_id = ?`, p.id); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("unable to delete profile keys: %v", err)
+	}
+	if _, err := tx.Exec(`delete from profiles where id = ?`, p.id); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("unable to delete profile: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("unable to delete profile: %v", err)
+	}
+	return nil
+}
+
+// AddKey associates an ssh public key with the profile, so that whoever holds
+// the key is logged in as this profile.
+func (p *Profile) AddKey(key ssh.PublicKey) error {
+	_, err := db.Exec(`
+        insert into profile_keys
+        (fingerprint, profile_id, key, created)
+        values
+        (?, ?, ?, ?)
+    ;`, ssh.FingerprintSHA256(key), p.id, string(ssh.MarshalAuthorizedKey(key)), time.Now())
+	if err != nil {
+		return fmt.Errorf("unable to add key to profile: %v", err)
+	}
 	return nil
 }
 
 func profilesTable() {
 	stmnt := `create table if not exists profiles (
         id integer not null primary key autoincrement,
-        name text unique
+        name text unique,
+        password blob
     );`
 	if _, err := db.Exec(stmnt); err != nil {
 		log_error("couldn't create profiles table: %v", err)
 	}
+	migrateProfiles()
+}
+
+// migrateProfiles adds the password column to profiles tables created before
+// profiles had passwords. Existing players are asked to pick a password the
+// next time they log in.
+func migrateProfiles() {
+	rows, err := db.Query(`pragma table_info(profiles)`)
+	if err != nil {
+		log_error("couldn't read profiles table info: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid, notnull, pk int
+			name, kind       string
+			dflt             sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &kind, &notnull, &dflt, &pk); err != nil {
+			log_error("couldn't read profiles table info: %v", err)
+			return
+		}
+		if name == "password" {
+			return
+		}
+	}
+	rows.Close()
+
+	log_info("adding password column to profiles table")
+	if _, err := db.Exec(`alter table profiles add column password blob`); err != nil {
+		log_error("couldn't add password column to profiles table: %v", err)
+	}
+}
+
+func profileKeysTable() {
+	stmnt := `create table if not exists profile_keys (
+        fingerprint text not null primary key,
+        profile_id integer not null references profiles(id),
+        key text,
+        created timestamp
+    );`
+	if _, err := db.Exec(stmnt); err != nil {
+		log_error("couldn't create profile_keys table: %v", err)
+	}
 }
 
 func loadProfile(name string) (*Profile, error) {
-	row := db.QueryRow(`select * from profiles where name = ?`, name)
+	row := db.QueryRow(`select id, name, password from profiles where name = ?`, name)
 	var p Profile
-	if err := row.Scan(&p.id, &p.name); err != nil {
+	if err := row.Scan(&p.id, &p.name, &p.password); err != nil {
 		return nil, fmt.Errorf("unable to fetch profile from database: %v", err)
 	}
 	return &p, nil
 }
+
+// loadProfileByKey finds the profile that an ssh public key belongs to.
+func loadProfileByKey(key ssh.PublicKey) (*Profile, error) {
+	row := db.QueryRow(`
+        select profiles.id, profiles.name, profiles.password
+        from profiles
+        join profile_keys on profile_keys.profile_id = profiles.id
+        where profile_keys.fingerprint = ?
+    ;`, ssh.FingerprintSHA256(key))
+	var p Profile
+	if err := row.Scan(&p.id, &p.name, &p.password); err != nil {
+		return nil, fmt.Errorf("unable to fetch profile for key: %v", err)
+	}
+	return &p, nil
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// protocol is the wire format spoken with a client. Telnet users get the
+// default text protocol. Bots and custom clients can ask for the JSON
+// protocol by sending a hello line as soon as they connect (websocket clients
+// and ssh clients ask for it when connecting instead; see serveWebsocket and
+// serveSSH):
+//
+//	{"protocol": "json"}
+//
+// In the JSON protocol, every line the client sends is a JSON object,
+// either a command:
+//
+//	{"command": "goto", "args": ["HD 113538"]}
+//
+// or a plain line of input, in response to a prompt:
+//
+//	{"line": "alice"}
+//
+// and every line the server sends is a JSON object with a "type" field
+// identifying the kind of event it describes.
+//
+// A client that joins a game is sent a session event carrying a resume
+// token. If the client's socket drops, it can reconnect and take back its seat
+// by answering the name prompt with the token instead of a name:
+//
+//	{"command": "resume", "args": ["3f2a..."]}
+type protocol int
+
+const (
+	textProtocol protocol = iota
+	jsonProtocol
+)
+
+// how long to wait for a client to ask for a protocol before assuming that
+// it's a person using telnet.
+const negotiateTimeout = 250 * time.Millisecond
+
+// jsonInput is a line of input in the JSON protocol.
+type jsonInput struct {
+	Protocol string   `json:"protocol,omitempty"`
+	Command  string   `json:"command,omitempty"`
+	Args     []string `json:"args,omitempty"`
+	Line     string   `json:"line,omitempty"`
+}
+
+// handshaker is implemented by transports whose clients choose a protocol as
+// part of connecting, rather than by sending a hello line.
+type handshaker interface {
+	handshakeProtocol() protocol
+}
+
+// negotiate gives a newly connected client a moment to ask for the JSON
+// protocol. Telnet negotiation starts once it's clear that the client isn't a
+// bot.
+func (c *Connection) negotiate() {
+	if c.Conn == nil {
+		return
+	}
+	// websocket and ssh clients pick their protocol when connecting, and a
+	// read deadline would break their sessions.
+	if h, ok := c.Conn.(handshaker); ok {
+		if h.handshakeProtocol() == jsonProtocol {
+			c.useJSON()
+		}
+		return
+	}
+	if c.requestedJSON() {
+		c.useJSON()
+		return
+	}
+	if t, ok := c.Conn.(*telnetConn); ok {
+		t.start()
+	}
+}
+
+// requestedJSON checks whether the client opened with a request for the JSON
+// protocol.
+func (c *Connection) requestedJSON() bool {
+	c.SetReadDeadline(time.Now().Add(negotiateTimeout))
+	b, err := c.Peek(1)
+	c.SetReadDeadline(time.Time{})
+	if err != nil || b[0] != '{' {
+		return false
+	}
+
+	line, err := c.ReadString('\n')
+	if err != nil {
+		return false
+	}
+	var hello jsonInput
+	if err := json.Unmarshal([]byte(line), &hello); err != nil || hello.Protocol != "json" {
+		c.Printf("unrecognized protocol request: %s\n", strings.TrimSpace(line))
+		return false
+	}
+	return true
+}
+
+func (c *Connection) useJSON() {
+	c.protocol = jsonProtocol
+	c.Emit(helloEvent{Protocol: "json", Version: 1})
+	c.Emit(stateEvent{State: c.ConnectionState.String()})
+}
+
+// readLine reads a single line of input from the player. In the JSON
+// protocol, a command object is flattened back into a line.
+func (c *Connection) readLine() (string, error) {
+	line, err := c.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if c.protocol != jsonProtocol {
+		return strings.TrimSpace(line), nil
+	}
+	in, err := c.decodeInput(line)
+	if err != nil {
+		return "", nil
+	}
+	if in.Line != "" {
+		return strings.TrimSpace(in.Line), nil
+	}
+	return strings.TrimSpace(strings.Join(append([]string{in.Command}, in.Args...), " ")), nil
+}
+
+// readCommand reads a command from the player, returning the command's name
+// followed by its arguments. readCommand returns nil parts for a blank line.
+func (c *Connection) readCommand() ([]string, error) {
+	line, err := c.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if c.protocol != jsonProtocol {
+		return parseLine(line), nil
+	}
+	in, err := c.decodeInput(line)
+	if err != nil {
+		return nil, nil
+	}
+	if in.Command == "" {
+		return parseLine(in.Line), nil
+	}
+	return append([]string{in.Command}, in.Args...), nil
+}
+
+func (c *Connection) decodeInput(line string) (*jsonInput, error) {
+	var in jsonInput
+	if strings.TrimSpace(line) == "" {
+		return &in, nil
+	}
+	if err := json.Unmarshal([]byte(line), &in); err != nil {
+		c.Emit(errorEvent{Error: fmt.Sprintf("unable to parse input: %v", err)})
+		return nil, err
+	}
+	return &in, nil
+}
+
+// event is a typed message sent to a player. In the JSON protocol an event is
+// sent as a JSON object, with its kind in the object's "type" field; in the
+// text protocol it's rendered as text.
+type event interface {
+	kind() string
+	render(w io.Writer)
+}
+
+// Emit sends an event to the player.
+func (c *Connection) Emit(e event) {
+	if c.protocol != jsonProtocol {
+		e.render(c)
+		return
+	}
+	body, err := json.Marshal(e)
+	if err != nil {
+		log_error("unable to encode %s event: %v", e.kind(), err)
+		return
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `{"type":%q`, e.kind())
+	if len(body) > 2 {
+		buf.WriteByte(',')
+		buf.Write(body[1 : len(body)-1])
+	}
+	buf.WriteString("}\n")
+	c.link.write(buf.Bytes())
+}
+
+// systemRef identifies a system in an event.
+type systemRef struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func (s *System) ref() *systemRef {
+	if s == nil {
+		return nil
+	}
+	return &systemRef{ID: s.id, Name: s.name}
+}
+
+// textEvent is free-form text. Anything written to a JSON protocol client that
+// doesn't have a more specific event type is sent as text.
+type textEvent struct {
+	Text string `json:"text"`
+}
+
+func (e textEvent) kind() string       { return "text" }
+func (e textEvent) render(w io.Writer) { io.WriteString(w, e.Text) }
+
+type helloEvent struct {
+	Protocol string `json:"protocol"`
+	Version  int    `json:"version"`
+}
+
+func (e helloEvent) kind() string       { return "hello" }
+func (e helloEvent) render(w io.Writer) {}
+
+type errorEvent struct {
+	Error string `json:"error"`
+}
+
+func (e errorEvent) kind() string       { return "error" }
+func (e errorEvent) render(w io.Writer) { fmt.Fprintln(w, e.Error) }
+
+// promptEvent asks the player to type something in.
+type promptEvent struct {
+	Prompt string `json:"prompt"`
+	Text   string `json:"text"`
+}
+
+func (e promptEvent) kind() string       { return "prompt" }
+func (e promptEvent) render(w io.Writer) { fmt.Fprintf(w, "\n\n%s\n", e.Text) }
+
+// stateEvent is sent whenever the player's state changes. It has no text
+// rendering; telnet users are told about state changes by the states
+// themselves.
+type stateEvent struct {
+	State    string     `json:"state"`
+	Location *systemRef `json:"location,omitempty"`
+}
+
+func (e stateEvent) kind() string       { return "state" }
+func (e stateEvent) render(w io.Writer) {}
+
+// locationEvent is sent when a player arrives at a system.
+type locationEvent struct {
+	System  systemRef `json:"system"`
+	Planets int       `json:"planets"`
+}
+
+func (e locationEvent) kind() string { return "location" }
+
+func (e locationEvent) render(w io.Writer) {
+	sys := fmt.Sprintf("%s (id: %v)", e.System.Name, e.System.ID)
+	if e.Planets == 1 {
+		fmt.Fprintf(w, "you are in the system %s. There is %d planet here.\n", sys, e.Planets)
+	} else {
+		fmt.Fprintf(w, "you are in the system %s. There are %d planets here.\n", sys, e.Planets)
+	}
+}
+
+func (e status) kind() string { return "status" }
+
+func (e status) render(w io.Writer) { statusTemplate.Execute(w, e) }
+
+// broadcastMessageEvent is a broadcast arriving at the player's system.
+type broadcastMessageEvent struct {
+	From    systemRef `json:"from"`
+	Message string    `json:"message"`
+}
+
+func (e broadcastMessageEvent) kind() string { return "broadcast" }
+
+func (e broadcastMessageEvent) render(w io.Writer) {
+	fmt.Fprintf(w, "message received from system %s (id: %v):\n\t%s\n", e.From.Name, e.From.ID, e.Message)
+}
+
+// observationEvent is sent when the light from something that happened
+// elsewhere in the galaxy reaches the player.
+type observationEvent struct {
+	Observed string    `json:"observed"`
+	System   systemRef `json:"system"`
+	Player   string    `json:"player,omitempty"`
+	Message  string    `json:"-"`
+}
+
+func (e observationEvent) kind() string       { return "observation" }
+func (e observationEvent) render(w io.Writer) { fmt.Fprintln(w, e.Message) }
+
+// scanResultEvent is the echo of a scan, arriving back at the scanner.
+type scanResultEvent struct {
+	System       systemRef `json:"system"`
+	Distance     float64   `json:"distance"`
+	Shielded     bool      `json:"shielded"`
+	ShieldEnergy float64   `json:"shield_energy,omitempty"`
+	Inhabitants  []string  `json:"inhabitants,omitempty"`
+	ColonizedBy  string    `json:"colonized_by,omitempty"`
+}
+
+func (e scanResultEvent) kind() string { return "scan" }
+
+func (e scanResultEvent) render(w io.Writer) {
+	fmt.Fprintf(w, "results from scan of %s (id: %v):\n", e.System.Name, e.System.ID)
+	fmt.Fprintf(w, "\tdistance: %v\n", e.Distance)
+	fmt.Fprintf(w, "\tshielded: %v\n", e.Shielded)
+	if e.Shielded {
+		fmt.Fprintf(w, "\tshield energy: %v\n", e.ShieldEnergy)
+	}
+	if len(e.Inhabitants) > 0 {
+		fmt.Fprintf(w, "\tinhabitants: %v\n", e.Inhabitants)
+	}
+	if e.ColonizedBy != "" {
+		fmt.Fprintf(w, "\tcolonized by: %v\n", e.ColonizedBy)
+	}
+}
+
+// deathEvent is sent when the player is killed.
+type deathEvent struct {
+	RespawnIn time.Duration `json:"respawn_in"`
+}
+
+func (e deathEvent) kind() string { return "death" }
+
+func (e deathEvent) render(w io.Writer) {
+	fmt.Fprintf(w, "You have died. You will respawn in %v.\n", e.RespawnIn)
+}
+
+// sessionEvent tells a player the token with which they can resume their
+// seat in a game if they're disconnected. It has no text rendering; telnet
+// users resume their seat by logging back in.
+type sessionEvent struct {
+	Game  string `json:"game"`
+	Token string `json:"token"`
+}
+
+func (e sessionEvent) kind() string       { return "session" }
+func (e sessionEvent) render(w io.Writer) {}
+
+// victoryEvent is sent to every player when the game has been won.
+type victoryEvent struct {
+	Winner string `json:"winner"`
+	Method string `json:"method"`
+}
+
+func (e victoryEvent) kind() string { return "victory" }
+
+func (e victoryEvent) render(w io.Writer) {
+	fmt.Fprintf(w, "player %s has won by %s victory.\n", e.Winner, e.Method)
+}
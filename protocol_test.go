@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestJSONProtocol(t *testing.T) {
+	name := uniqueName("robot")
+	bot := newClient(t, name, func(sock net.Conn) *Connection {
+		go handleConnection(sock)
+		return nil
+	})
+	bot.Write(`{"protocol": "json"}` + "\n")
+	bot.Expect(`{"type":"hello","protocol":"json","version":1}`)
+	bot.Expect(`{"type":"prompt","prompt":"name"`)
+
+	bot.Write(`{"line": "` + name + `"}` + "\n")
+	bot.Expect(`{"type":"prompt","prompt":"new-password"`)
+	bot.Write(`{"line": "beepboop"}` + "\n")
+	bot.Expect(`{"type":"prompt","prompt":"confirm-password"`)
+	bot.Write(`{"line": "beepboop"}` + "\n")
+	bot.Expect(`{"type":"state","state":"Lobby"}`)
+
+	bot.Write(`{"command": "new"}` + "\n")
+	bot.Expect(`{"type":"state","state":"Staging"}`)
+	bot.Write(`{"command": "start"}` + "\n")
+	bot.Expect(`{"type":"location","system":{"id":`)
+
+	bot.Write(`{"command": "status"}` + "\n")
+	bot.Expect(`{"type":"status","state":"idle on `)
+
+	bot.Write(`{"command": "help", "args": ["goto"]}` + "\n")
+	bot.Expect(`{"type":"text","text":`)
+
+	bot.Write("not json\n")
+	bot.Expect(`{"type":"error","error":"unable to parse input: `)
+	bot.Refute("A game of dark cunning")
+}
+
+func TestTextProtocolIsTheDefault(t *testing.T) {
+	h := newHarness(t)
+	alice := h.Join("alice", 1)
+	alice.Send("status")
+	h.Step(1)
+	alice.Expect("Current State: idle on Alpha")
+	alice.Refute(`"type"`)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+)
+
+// replay re-simulates a recorded game without any network clients and checks
+// that it reaches the same outcome as the one stored for it in the games
+// table.
+func replay(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("unable to open game log: %v", err)
+	}
+	entries, err := readGameLog(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	log_info("replaying game log %s", path)
+	g, err := replayGame(entries)
+	if err != nil {
+		return err
+	}
+
+	var winner, method sql.NullString
+	row := db.QueryRow(`select winner, win_method from games where id = ?`, g.id)
+	if err := row.Scan(&winner, &method); err != nil {
+		return fmt.Errorf("unable to read stored result for game %s: %v", g.id, err)
+	}
+
+	log_info("replayed winner: %q by %q", g.winner, g.winMethod)
+	log_info("stored winner:   %q by %q", winner.String, method.String)
+	if g.winner != winner.String || g.winMethod != method.String {
+		return fmt.Errorf("replayed outcome of game %s does not match the stored outcome", g.id)
+	}
+	return nil
+}
+
+// replayGame re-simulates the game recorded by a log, up to the frame on which
+// it was won or the end of the log, and gives the game as it was then.
+func replayGame(entries []logEntry) (*Game, error) {
+	start := entries[0]
+	rules := defaultRules()
+	if start.Config != nil {
+		rules = *start.Config
+	}
+	g := NewGame(start.Seed, newManualClock(time.Time{}), rules)
+	if g.id != start.Game {
+		return nil, fmt.Errorf("seed %d produced game %s but the log is for game %s; is the planets table the same?", start.Seed, g.id, start.Game)
+	}
+	log_info("replaying game %s", g.id)
+
+	players := make(map[string]*Connection)
+	defer func() {
+		for _, conn := range players {
+			conn.Close()
+		}
+	}()
+
+	// games recorded before games had a staging room began straight away
+	g.started = true
+	for _, e := range entries {
+		if e.Type == "begin" {
+			g.started = false
+		}
+	}
+
+	i := 1
+	for g.winner == "" && i < len(entries) {
+		// as in Game.tick, no time passes while the game is in its staging
+		// room
+		staging := !g.started
+		if !staging {
+			g.frame += 1
+		}
+		applied := i
+		for ; i < len(entries) && entries[i].Frame <= g.frame; i++ {
+			e := entries[i]
+			switch e.Type {
+			case "join":
+				conn := newConnection(nil)
+				conn.profile = &Profile{name: e.Player}
+				conn.game = g
+				players[e.Player] = conn
+				joinMessage{conn: conn}.Apply(g)
+			case "command":
+				conn, ok := players[e.Player]
+				if !ok {
+					return nil, fmt.Errorf("frame %d: command from unknown player %s", e.Frame, e.Player)
+				}
+				commandMessage{conn: conn, name: e.Command, args: e.Args}.Apply(g)
+			case "quit":
+				conn, ok := players[e.Player]
+				if !ok {
+					return nil, fmt.Errorf("frame %d: unknown player %s quit", e.Frame, e.Player)
+				}
+				// as in quitMessage and expireSeats
+				if g.started {
+					g.Quit(conn)
+				} else {
+					g.leaveStaging(conn)
+				}
+				conn.Close()
+				delete(players, e.Player)
+			case "begin":
+				g.begin()
+			case "resume":
+				return nil, fmt.Errorf("game %s was restored from a snapshot on frame %d and can't be replayed past that point", g.id, e.Frame)
+			case "end", "reclaim", "detach":
+			default:
+				return nil, fmt.Errorf("frame %d: unknown log entry type %q", e.Frame, e.Type)
+			}
+		}
+		if staging {
+			if i == applied {
+				return nil, fmt.Errorf("frame %d: log entry recorded before the game began", entries[i].Frame)
+			}
+			continue
+		}
+		g.update()
+	}
+	log_info("replay of game %s finished on frame %d", g.id, g.frame)
+	return g, nil
+}
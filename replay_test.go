@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReplay(t *testing.T) {
+	rules := defaultRules()
+	rules.Shape, rules.Stars = "cube", 20
+	rules.Economic = rules.StartMoney + 200
+	g := NewGame(7, newManualClock(time.Time{}), rules)
+	if err := g.Create(); err != nil {
+		t.Fatalf("unable to create game: %v", err)
+	}
+	l, err := createGameLog(g)
+	if err != nil {
+		t.Fatalf("unable to create game log: %v", err)
+	}
+	g.log = l
+	g.onEnd = func(g *Game) {
+		if err := g.Store(); err != nil {
+			t.Errorf("unable to store game: %v", err)
+		}
+		g.log.Close()
+	}
+	h := &harness{t: t, game: g}
+
+	// the host leaves before the game begins, and bob takes over
+	alice := h.Stage("alice")
+	bob := h.Stage("bob")
+	carol := h.Stage("carol")
+	carol.Send("ready")
+	h.Step(1)
+	h.drop(alice)
+	h.Step(1)
+	bob.Send("start")
+	h.Step(1)
+	if !g.started || g.host != "bob" {
+		t.Fatalf("expected bob to have started the game, host is %q", g.host)
+	}
+
+	bob.Send("mine")
+	carol.Send("scan")
+	carol.Send("broadcast anyone out there?")
+	h.Step(50)
+	carol.Send("mine")
+	for i := 0; i < 1000 && g.winner == ""; i++ {
+		h.Step(1)
+	}
+	if g.winner == "" {
+		t.Fatalf("nobody won the game")
+	}
+
+	f, err := os.Open(gameLogPath(g.id))
+	if err != nil {
+		t.Fatalf("unable to open game log: %v", err)
+	}
+	entries, err := readGameLog(f)
+	f.Close()
+	if err != nil {
+		t.Fatalf("unable to read game log: %v", err)
+	}
+	replayed, err := replayGame(entries)
+	if err != nil {
+		t.Fatalf("unable to replay game: %v", err)
+	}
+	if replayed.winner != g.winner || replayed.winMethod != g.winMethod || replayed.host != g.host {
+		t.Fatalf("replay was won by %q by %q with host %q; the game was won by %q by %q with host %q",
+			replayed.winner, replayed.winMethod, replayed.host, g.winner, g.winMethod, g.host)
+	}
+	if want, got := gameState(g), gameState(replayed); want != got {
+		t.Fatalf("replayed game differs from the original.\noriginal:\n%s\nreplayed:\n%s", want, got)
+	}
+
+	if err := replay(gameLogPath(g.id)); err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// maxSuggestions is the most systems a player is offered to choose from when
+// it isn't clear which one they meant.
+const maxSuggestions = 10
+
+// systemNameHelp explains to players how to name a system, for the help of
+// every command that takes one.
+const systemNameHelp = `
+A system can be given by its id or its name. Names needn't be typed in full,
+nor with the right capitals, spaces or punctuation: "hd113" finds HD 113538 if
+no other system's name begins that way. If a name could mean more than one
+system, you'll be asked which one you meant.
+`
+
+// Resolve finds the systems that a player could mean by the given id or name.
+// If the player's meaning is clear, sure is set and the one system is given:
+// the system with that id, the one with that name, or the only one whose name
+// begins with it, ignoring case, spacing and punctuation. Otherwise the
+// candidates are given, best first: the systems whose names begin with it,
+// failing those the ones whose names contain it, and failing those the ones
+// whose names are a slip of the keyboard away from it.
+func (g *Galaxy) Resolve(query string) (matches []*System, sure bool) {
+	if id, err := strconv.Atoi(strings.TrimSpace(query)); err == nil {
+		if sys := g.GetSystemByID(id); sys != nil {
+			return []*System{sys}, true
+		}
+	}
+	if sys := g.GetSystemByName(query); sys != nil {
+		return []*System{sys}, true
+	}
+	return matchName(g.Systems(), query)
+}
+
+// resolveName is Galaxy.Resolve for a list of systems that hasn't been made
+// into a galaxy yet, such as a catalog that a galaxy is to be picked from.
+func resolveName(systems []*System, query string) (matches []*System, sure bool) {
+	if id, err := strconv.Atoi(strings.TrimSpace(query)); err == nil {
+		for _, sys := range systems {
+			if sys.id == id {
+				return []*System{sys}, true
+			}
+		}
+	}
+	key := nameKey(query)
+	for _, sys := range systems {
+		if nameKey(sys.name) == key {
+			return []*System{sys}, true
+		}
+	}
+	return matchName(systems, query)
+}
+
+// matchName finds the systems whose names a partial or misspelled name could
+// be meant for, as described for Galaxy.Resolve.
+func matchName(systems []*System, query string) (matches []*System, sure bool) {
+	q := compactName(query)
+	if q == "" {
+		return nil, false
+	}
+
+	var prefixed, containing []*System
+	for _, sys := range systems {
+		name := compactName(sys.name)
+		if name == q {
+			return []*System{sys}, true
+		}
+		if strings.HasPrefix(name, q) {
+			prefixed = append(prefixed, sys)
+		} else if strings.Contains(name, q) {
+			containing = append(containing, sys)
+		}
+	}
+	switch {
+	case len(prefixed) == 1:
+		return prefixed, true
+	case len(prefixed) > 0:
+		return prefixed, false
+	case len(containing) > 0:
+		return containing, false
+	}
+
+	// a slip of the keyboard is an edit or so for every few characters
+	limit := len(q) / 4
+	if limit < 1 {
+		limit = 1
+	}
+	dist := make(map[*System]int)
+	for _, sys := range systems {
+		if d := editDistance(q, compactName(sys.name)); d <= limit {
+			dist[sys] = d
+			matches = append(matches, sys)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return dist[matches[i]] < dist[matches[j]] })
+	return matches, false
+}
+
+// pickSystem resolves a system's name where the player can't be asked which
+// system they meant, e.g. in the options to new. It's an error for the name
+// to mean anything but a single system.
+func pickSystem(systems []*System, query string) (*System, error) {
+	matches, sure := resolveName(systems, query)
+	if sure {
+		return matches[0], nil
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no such system: %s", query)
+	}
+	var names []string
+	for i, sys := range matches {
+		if i == maxSuggestions {
+			names = append(names, "...")
+			break
+		}
+		names = append(names, sys.name)
+	}
+	if strings.HasPrefix(compactName(matches[0].name), compactName(query)) {
+		return nil, fmt.Errorf("%s could be any of %d systems: %s", query, len(matches), strings.Join(names, ", "))
+	}
+	return nil, fmt.Errorf("no such system: %s. Did you mean: %s?", query, strings.Join(names, ", "))
+}
+
+// compactName is the form of a name that partial names are matched against:
+// lower case, with only its letters and digits.
+func compactName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+}
+
+// editDistance counts the characters that have to be added, removed or
+// changed to turn one string into the other.
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	prev, cur := make([]int, len(t)+1), make([]int, len(t)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		cur[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(t)]
+}
+
+// systemChoice is a question put to a player about which system they meant.
+// If the next thing they type is the number of one of the options, the
+// command is run again with it.
+type systemChoice struct {
+	command string
+	options []*System
+}
+
+// resolveSystem finds the system named by the arguments to a command. If
+// there's no telling which system the player meant, they're told so, and nil
+// is returned. When there are a few systems they could have meant, they're
+// asked to choose one.
+func (c *Connection) resolveSystem(command string, args []string) *System {
+	query := strings.Join(args, " ")
+	if strings.TrimSpace(query) == "" {
+		c.Printf("which system? Give the name or id of a system.\n")
+		return nil
+	}
+	matches, sure := c.game.galaxy.Resolve(query)
+	if sure {
+		return matches[0]
+	}
+	if len(matches) == 0 {
+		c.Printf("no such system: %s\n", query)
+		return nil
+	}
+
+	if strings.HasPrefix(compactName(matches[0].name), compactName(query)) {
+		c.Printf("%s could be any of %d systems:\n", query, len(matches))
+	} else {
+		c.Printf("no such system: %s. Did you mean:\n", query)
+	}
+	more := len(matches) - maxSuggestions
+	if more > 0 {
+		matches = matches[:maxSuggestions]
+	}
+	for i, sys := range matches {
+		c.Printf("  %2d. %v\n", i+1, sys)
+	}
+	if more > 0 {
+		c.Printf("  ...and %d more. Give more of the name to narrow them down.\n", more)
+	}
+	c.Printf("Type the number of the one you mean.\n")
+	c.choice = &systemChoice{command: command, options: matches}
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLine(t *testing.T) {
+	cases := []struct {
+		line string
+		want []string
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"goto 12", []string{"goto", "12"}},
+		{"  goto   12  ", []string{"goto", "12"}},
+		{`goto "HD 113538"`, []string{"goto", "HD 113538"}},
+		{`goto 'HD 113538'`, []string{"goto", "HD 113538"}},
+		{`goto "HD 113538`, []string{"goto", "HD 113538"}},
+		{`say it's "really" far`, []string{"say", "it's", "really", "far"}},
+		{`say "she said 'hi'"`, []string{"say", "she said 'hi'"}},
+		{`goto ""`, []string{"goto", ""}},
+		{`new size=10 center="HD 113538"`, []string{"new", "size=10", "center=HD 113538"}},
+		{`new center='Tau Ceti' radius=5`, []string{"new", "center=Tau Ceti", "radius=5"}},
+	}
+	for _, c := range cases {
+		if got := parseLine(c.line); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("parseLine(%q) = %q, want %q", c.line, got, c.want)
+		}
+	}
+}
+
+func resolveTestGalaxy() []*System {
+	return []*System{
+		testSystem(1, "Kepler-10", 0, 0, 0),
+		testSystem(2, "Kepler-11", 1, 0, 0),
+		testSystem(3, "HD 113538", 0, 1, 0),
+		testSystem(4, "Gliese 581", 0, 0, 1),
+		testSystem(5, "Tau Ceti", 1, 1, 0),
+	}
+}
+
+func TestResolve(t *testing.T) {
+	h := newHarness(t, resolveTestGalaxy()...)
+	g := h.game.galaxy
+
+	cases := []struct {
+		query string
+		want  []int
+		sure  bool
+	}{
+		{"4", []int{4}, true},
+		{"hd 113538", []int{3}, true},
+		{"HD113538", []int{3}, true},
+		{"hd113", []int{3}, true},
+		{"tau", []int{5}, true},
+		{"kepler", []int{1, 2}, false},
+		{"kepler 1", []int{1, 2}, false},
+		{"ceti", []int{5}, false},
+		{"gleise 581", []int{4}, false},
+		{"vega", nil, false},
+		{"99", nil, false},
+		{"--", nil, false},
+	}
+	for _, c := range cases {
+		matches, sure := g.Resolve(c.query)
+		var got []int
+		for _, sys := range matches {
+			got = append(got, sys.id)
+		}
+		if !reflect.DeepEqual(got, c.want) || sure != c.sure {
+			t.Errorf("Resolve(%q) = %v, %t; want %v, %t", c.query, got, sure, c.want, c.sure)
+		}
+	}
+}
+
+func TestGotoMultiWordName(t *testing.T) {
+	h := newHarness(t, resolveTestGalaxy()...)
+	alice := h.Join("alice", 1)
+	bob := h.Join("bob", 1)
+
+	alice.Send(`goto "HD 113538"`)
+	bob.Send("goto HD 113538")
+	h.Step(1)
+	for _, cl := range []*client{alice, bob} {
+		travel, ok := cl.conn.ConnectionState.(*TravelState)
+		if !ok || travel.dest != h.System(3) {
+			t.Fatalf("expected %s to be travelling to HD 113538, is %v", cl.name, cl.conn.ConnectionState)
+		}
+	}
+}
+
+func TestChooseSystem(t *testing.T) {
+	h := newHarness(t, resolveTestGalaxy()...)
+	alice := h.Join("alice", 3)
+
+	alice.Send("goto kepler")
+	h.Step(1)
+	alice.Expect("kepler could be any of 2 systems")
+	alice.Expect("2. Kepler-11")
+	if _, ok := alice.conn.ConnectionState.(*IdleState); !ok {
+		t.Fatalf("alice should be waiting to choose, she is %v", alice.conn.ConnectionState)
+	}
+
+	alice.Send("2")
+	h.Step(1)
+	travel, ok := alice.conn.ConnectionState.(*TravelState)
+	if !ok || travel.dest != h.System(2) {
+		t.Fatalf("expected alice to be travelling to Kepler-11, she is %v", alice.conn.ConnectionState)
+	}
+}
+
+func TestChoiceIsForgotten(t *testing.T) {
+	h := newHarness(t, resolveTestGalaxy()...)
+	alice := h.Join("alice", 3)
+
+	alice.Send("goto gleise 581")
+	h.Step(1)
+	alice.Expect("no such system: gleise 581. Did you mean")
+	alice.Expect("1. Gliese 581")
+
+	// anything else typed in the meantime means the question goes unanswered
+	alice.Send("nearby")
+	alice.Send("1")
+	h.Step(1)
+	if _, ok := alice.conn.ConnectionState.(*IdleState); !ok {
+		t.Fatalf("alice should not have gone anywhere, she is %v", alice.conn.ConnectionState)
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Rules is the set of options that affect how a game is simulated. Every game
+// carries its own copy, which is written at the head of the game's log so that
+// the game can be replayed with the rules it was played with.
+type Rules struct {
+	Name           string   `json:"name,omitempty"`
+	BombCost       int      `json:"bomb_cost"`
+	BombReloadTime duration `json:"bomb_reload_time"`
+	BombSpeed      float64  `json:"bomb_speed"`
+	Catalog        string   `json:"catalog,omitempty"`        // path to the star catalog; empty means the server's own
+	CatalogFormat  string   `json:"catalog_format,omitempty"` // format of the catalog, if not given by its extension
+	Center         string   `json:"center,omitempty"`         // system the galaxy is picked around: a name, an id, "cluster", or empty for a random one
+	ColonyCost     int      `json:"colony_cost"`
+	Economic       int      `json:"economic"`
+	FrameRate      int      `json:"frame_rate"`
+	Density        float64  `json:"density,omitempty"`     // systems per cubic parsec in a generated galaxy; 0 means 0.001
+	GalaxySeed     int64    `json:"galaxy_seed,omitempty"` // seed of a generated galaxy; 0 means the game's own seed
+	GalaxySize     int      `json:"galaxy_size,omitempty"` // number of systems in play; 0 means all of them
+	LightSpeed     float64  `json:"light_speed"`
+	MakeBombTime   duration `json:"make_bomb_time"`
+	MakeColonyTime duration `json:"make_colony_time"`
+	MakeShieldTime duration `json:"make_shield_time"`
+	MoneyMean      float64  `json:"money_mean"`
+	MoneySigma     float64  `json:"money_sigma"`
+	PlanetMean     float64  `json:"planet_mean,omitempty"` // mean number of planets per generated system; 0 means 1.5
+	PlayerSpeed    float64  `json:"player_speed"`
+	Radius         float64  `json:"radius,omitempty"` // how far, in parsecs, systems in play may be from the center; 0 means any distance
+	RespawnTime    duration `json:"respawn_time"`
+	ScanTime       duration `json:"scan_time"`
+	Shape          string   `json:"shape,omitempty"` // shape of a generated galaxy; empty means the galaxy comes from a star catalog
+	SpawnDistance  float64  `json:"spawn_distance"`  // the closest, in parsecs, that players are placed to each other
+	StartBombs     int      `json:"start_bombs"`
+	StartCountdown duration `json:"start_countdown"` // how long the countdown to the start of the game lasts, in human time
+	StartMoney     int      `json:"start_money"`
+	Stars          int      `json:"stars,omitempty"`     // number of systems in a generated galaxy; 0 means 500
+	Victories      []string `json:"victories,omitempty"` // the ways a game can be won; empty means every way
+}
+
+// victories are the ways in which a game can be won.
+var victories = []string{"economic", "military"}
+
+// defaultRules are the rules given by the server's command line flags. Every
+// rule set is applied on top of them.
+func defaultRules() Rules {
+	return Rules{
+		BombCost:       options.bombCost,
+		BombReloadTime: duration(options.bombReloadTime),
+		BombSpeed:      options.bombSpeed,
+		ColonyCost:     options.colonyCost,
+		Economic:       options.economic,
+		FrameRate:      options.frameRate,
+		LightSpeed:     options.lightSpeed,
+		MakeBombTime:   duration(options.makeBombTime),
+		MakeColonyTime: duration(options.makeColonyTime),
+		MakeShieldTime: duration(options.makeShieldTime),
+		MoneyMean:      options.moneyMean,
+		MoneySigma:     options.moneySigma,
+		PlayerSpeed:    options.playerSpeed,
+		RespawnTime:    duration(options.respawnTime),
+		ScanTime:       duration(options.scanTime),
+		SpawnDistance:  options.spawnDistance,
+		StartBombs:     options.startBombs,
+		StartCountdown: duration(options.startCountdown),
+		StartMoney:     options.startMoney,
+	}
+}
+
+// maxFrameRate is the most frames per second a game may be simulated at. Much
+// faster and a single game would keep a core busy, and at a billion or so a
+// frame no longer lasts a measurable time.
+const maxFrameRate = 1000
+
+// validate checks that a game could be played with the rules.
+func (r Rules) validate() error {
+	switch {
+	case r.FrameRate <= 0:
+		return fmt.Errorf("frame_rate must be positive")
+	case r.FrameRate > maxFrameRate:
+		return fmt.Errorf("frame_rate can be at most %d", maxFrameRate)
+	case r.LightSpeed <= 0:
+		return fmt.Errorf("light_speed must be positive")
+	case r.PlayerSpeed <= 0:
+		return fmt.Errorf("player_speed must be positive")
+	case r.BombSpeed <= 0:
+		return fmt.Errorf("bomb_speed must be positive")
+	case r.Economic <= 0:
+		return fmt.Errorf("economic must be positive")
+	case r.StartCountdown < 0:
+		return fmt.Errorf("start_countdown can't be negative")
+	case r.SpawnDistance < 0:
+		return fmt.Errorf("spawn_distance can't be negative")
+	case r.GalaxySize < 0:
+		return fmt.Errorf("galaxy_size can't be negative")
+	case r.Radius < 0:
+		return fmt.Errorf("radius can't be negative")
+	case r.Center != "" && r.GalaxySize == 0 && r.Radius == 0:
+		return fmt.Errorf("a center only picks part of the galaxy given a galaxy_size or radius")
+	case r.Shape != "" && !contains(galaxyShapes, r.Shape):
+		return fmt.Errorf("unknown shape %q; shapes are %s", r.Shape, strings.Join(galaxyShapes, ", "))
+	case r.Stars < 0 || r.Stars == 1:
+		return fmt.Errorf("stars must be at least 2")
+	case r.Stars > maxStars:
+		return fmt.Errorf("stars can be at most %d", maxStars)
+	case r.Density < 0:
+		return fmt.Errorf("density can't be negative")
+	case r.Density > maxDensity:
+		return fmt.Errorf("density can be at most %v", maxDensity)
+	case r.PlanetMean != 0 && r.PlanetMean < 1:
+		return fmt.Errorf("planet_mean must be at least 1")
+	case r.PlanetMean > maxPlanetMean:
+		return fmt.Errorf("planet_mean can be at most %v", maxPlanetMean)
+	}
+	for _, v := range r.Victories {
+		if !contains(victories, v) {
+			return fmt.Errorf("unknown victory %q; victories are %s", v, strings.Join(victories, ", "))
+		}
+	}
+	return nil
+}
+
+// canWin checks whether a game played by the rules may be won by the given
+// method.
+func (r Rules) canWin(method string) bool {
+	return len(r.Victories) == 0 || contains(r.Victories, method)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// frameLength is the amount of human time that passes in one frame.
+func (r Rules) frameLength() time.Duration {
+	return time.Second / time.Duration(r.FrameRate)
+}
+
+// frames converts a duration in human time to a number of in-game frames.
+func (r Rules) frames(d time.Duration) int64 {
+	return int64(d / r.frameLength())
+}
+
+// duration converts a number of in-game frames to human time.
+func (r Rules) duration(frames int64) time.Duration {
+	return r.frameLength() * time.Duration(frames)
+}
+
+// lightFrames is the number of frames it takes for light to cross the given
+// distance, in parsecs.
+func (r Rules) lightFrames(dist float64) int64 {
+	return int64(math.Ceil(dist / r.LightSpeed))
+}
+
+// tripTime is how long a ship takes to travel the given distance, in parsecs.
+func (r Rules) tripTime(dist float64) time.Duration {
+	return r.duration(int64(dist / (r.PlayerSpeed * r.LightSpeed)))
+}
+
+// duration is a time.Duration that's written as a string such as "5s" in
+// config files and game logs. A plain number of nanoseconds is also accepted,
+// since that's how durations were written in older game logs.
+type duration time.Duration
+
+func (d duration) String() string { return time.Duration(d).String() }
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		*d = duration(v)
+		return nil
+	}
+	v, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid duration %s", b)
+	}
+	*d = duration(v)
+	return nil
+}
+
+// ruleSets are the named rule sets that a game can be started with, each
+// written as the fields it changes from the default rules. More can be added,
+// and these replaced, in the server's config file.
+var ruleSets = map[string]json.RawMessage{
+	"classic": json.RawMessage(`{}`),
+	"blitz": json.RawMessage(`{
+		"bomb_reload_time": "2s",
+		"bomb_speed": 1.8,
+		"economic": 15000,
+		"make_bomb_time": "2s",
+		"make_colony_time": "5s",
+		"make_shield_time": "5s",
+		"player_speed": 1.6,
+		"respawn_time": "20s",
+		"scan_time": "20s",
+		"start_money": 3000
+	}`),
+	"economic": json.RawMessage(`{
+		"colony_cost": 1500,
+		"economic": 50000,
+		"money_mean": 15000,
+		"money_sigma": 3000
+	}`),
+	"tiny": json.RawMessage(`{
+		"shape": "cube",
+		"stars": 20
+	}`),
+}
+
+// lookupRules finds the rule set with the given name.
+func lookupRules(name string) (Rules, error) {
+	overrides, ok := ruleSets[name]
+	if !ok {
+		return Rules{}, fmt.Errorf("no such rule set: %s", name)
+	}
+	rules := defaultRules()
+	dec := json.NewDecoder(bytes.NewReader(overrides))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rules); err != nil {
+		return Rules{}, fmt.Errorf("bad rule set %s: %v", name, err)
+	}
+	rules.Name = name
+	if err := rules.validate(); err != nil {
+		return Rules{}, fmt.Errorf("bad rule set %s: %v", name, err)
+	}
+	return rules, nil
+}
+
+// ruleSetNames lists the names of the rule sets, in alphabetical order.
+func ruleSetNames() []string {
+	names := make([]string, 0, len(ruleSets))
+	for name := range ruleSets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var rulesTemplate = template.Must(template.New("rules").Parse(`
+Rule set:          {{.Name}}
+Frame rate:        {{.FrameRate}} frames per second
+Galaxy:            {{if .Shape}}generated {{.Shape}}{{if .Stars}} of {{.Stars}} systems{{end}}{{else}}star catalog{{end}}
+Galaxy size:       {{if .GalaxySize}}{{.GalaxySize}} systems{{else}}every system{{end}}{{if .Radius}} within {{.Radius}} parsecs{{end}}{{if or .GalaxySize .Radius}} of {{if eq .Center ""}}a random system{{else if eq .Center "cluster"}}the densest cluster{{else}}{{.Center}}{{end}}{{end}}
+Light speed:       {{.LightSpeed}} parsecs per frame
+Ship speed:        {{.PlayerSpeed}}c
+Bomb speed:        {{.BombSpeed}}c
+Starting money:    {{.StartMoney}}
+Starting bombs:    {{.StartBombs}}
+Bomb cost:         {{.BombCost}}
+Bomb build time:   {{.MakeBombTime}}
+Bomb reload time:  {{.BombReloadTime}}
+Colony cost:       {{.ColonyCost}}
+Colony build time: {{.MakeColonyTime}}
+Shield build time: {{.MakeShieldTime}}
+Scanner recharge:  {{.ScanTime}}
+Respawn time:      {{.RespawnTime}}
+Spawn distance:    {{.SpawnDistance}} parsecs
+System money:      {{.MoneyMean}} (std dev {{.MoneySigma}})
+Economic victory:  {{.Economic}}
+Start countdown:   {{.StartCountdown}}
+Victories:         {{if .Victories}}{{range $i, $v := .Victories}}{{if $i}}, {{end}}{{$v}}{{end}}{{else}}economic, military{{end}}
+`))
+
+var rulesCommand = Command{
+	name:     "rules",
+	summary:  "lists the rule sets that games can be played by",
+	usage:    "rules [rule-set]",
+	arity:    1,
+	variadic: false,
+	handler: func(c *Connection, args ...string) {
+		if len(args) == 0 {
+			for _, name := range ruleSetNames() {
+				if name == options.rules {
+					c.Printf("%s (default)\n", name)
+				} else {
+					c.Printf("%s\n", name)
+				}
+			}
+			return
+		}
+		rules, err := lookupRules(args[0])
+		if err != nil {
+			c.Printf("No such rule set: %s\n", args[0])
+			return
+		}
+		rulesTemplate.Execute(c, rules)
+	},
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLookupRules(t *testing.T) {
+	classic, err := lookupRules("classic")
+	if err != nil {
+		t.Fatalf("unable to look up classic rules: %v", err)
+	}
+	blitz, err := lookupRules("blitz")
+	if err != nil {
+		t.Fatalf("unable to look up blitz rules: %v", err)
+	}
+	if blitz.Name != "blitz" {
+		t.Fatalf("expected blitz rules to be named blitz, got %q", blitz.Name)
+	}
+	if time.Duration(blitz.MakeBombTime) != 2*time.Second {
+		t.Fatalf("expected blitz bombs to take 2s to make, got %v", blitz.MakeBombTime)
+	}
+	if blitz.BombCost != classic.BombCost {
+		t.Fatalf("blitz rules should keep the default bomb cost, got %d", blitz.BombCost)
+	}
+	if _, err := lookupRules("calvinball"); err == nil {
+		t.Fatalf("expected an error looking up a rule set that doesn't exist")
+	}
+}
+
+func TestRulesJSON(t *testing.T) {
+	var r Rules
+	if err := json.Unmarshal([]byte(`{"frame_rate": 10, "scan_time": 5000000000, "respawn_time": "30s"}`), &r); err != nil {
+		t.Fatalf("unable to parse rules: %v", err)
+	}
+	if time.Duration(r.ScanTime) != 5*time.Second {
+		t.Fatalf("expected a duration in nanoseconds to be read as 5s, got %v", r.ScanTime)
+	}
+	if time.Duration(r.RespawnTime) != 30*time.Second {
+		t.Fatalf("expected a duration string to be read as 30s, got %v", r.RespawnTime)
+	}
+	if r.frames(time.Second) != 10 {
+		t.Fatalf("expected 10 frames per second, got %d", r.frames(time.Second))
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatalf("unable to encode rules: %v", err)
+	}
+	if !strings.Contains(string(b), `"respawn_time":"30s"`) {
+		t.Fatalf("expected durations to be written as strings, got %s", b)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	defaultSet, sets := options.rules, ruleSets["marathon"]
+	t.Cleanup(func() {
+		options.rules = defaultSet
+		delete(ruleSets, "marathon")
+		if sets != nil {
+			ruleSets["marathon"] = sets
+		}
+	})
+
+	path := filepath.Join(t.TempDir(), "exo.json")
+	config := `{
+		"options": {"rules": "marathon"},
+		"rules": {"marathon": {"economic": 100000, "respawn_time": "2m"}}
+	}`
+	if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatalf("unable to write config: %v", err)
+	}
+	if err := loadConfig(path); err != nil {
+		t.Fatalf("unable to load config: %v", err)
+	}
+	if err := checkRuleSets(); err != nil {
+		t.Fatalf("config produced bad rule sets: %v", err)
+	}
+	if options.rules != "marathon" {
+		t.Fatalf("expected the default rule set to be marathon, got %q", options.rules)
+	}
+	rules, err := lookupRules("marathon")
+	if err != nil {
+		t.Fatalf("unable to look up rule set from config: %v", err)
+	}
+	if rules.Economic != 100000 || time.Duration(rules.RespawnTime) != 2*time.Minute {
+		t.Fatalf("rule set from config has the wrong values: %+v", rules)
+	}
+
+	bad := filepath.Join(t.TempDir(), "bad.json")
+	if err := ioutil.WriteFile(bad, []byte(`{"rules": {"typo": {"ecnomic": 5}}}`), 0644); err != nil {
+		t.Fatalf("unable to write config: %v", err)
+	}
+	t.Cleanup(func() { delete(ruleSets, "typo") })
+	if err := loadConfig(bad); err != nil {
+		t.Fatalf("unable to load config: %v", err)
+	}
+	if err := checkRuleSets(); err == nil {
+		t.Fatalf("expected a misspelled rule to be rejected")
+	}
+}
+
+func TestCheckRuleSetsWithCatalog(t *testing.T) {
+	t.Cleanup(func() {
+		delete(ruleSets, "deep-space")
+		delete(ruleSets, "lost-in-space")
+	})
+
+	catalog := writeCatalog(t, "stars.csv", "name,x,y,z\nA,0,0,0\nB,1,0,0\nC,0,1,0\n")
+	path := filepath.Join(t.TempDir(), "exo.json")
+	config := `{"rules": {"deep-space": {"catalog": "` + catalog + `", "galaxy_size": 2}}}`
+	if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatalf("unable to write config: %v", err)
+	}
+	if err := loadConfig(path); err != nil {
+		t.Fatalf("unable to load config: %v", err)
+	}
+	if err := checkRuleSets(); err != nil {
+		t.Fatalf("config with a catalog produced bad rule sets: %v", err)
+	}
+	if systems, err := loadCatalog(catalog, ""); err != nil || len(systems) != 3 {
+		t.Fatalf("expected the catalog to have been read, got %d systems and %v", len(systems), err)
+	}
+
+	ruleSets["lost-in-space"] = json.RawMessage(`{"catalog": "` + filepath.Join(t.TempDir(), "nowhere.csv") + `"}`)
+	if err := checkRuleSets(); err == nil || !strings.Contains(err.Error(), "bad rule set lost-in-space") {
+		t.Fatalf("expected a rule set with a missing catalog to be rejected, got %v", err)
+	}
+}
+
+func TestNewGameWithRules(t *testing.T) {
+	alice := login(t, uniqueName("alice"), "hunter2")
+
+	alice.Write("new calvinball\n")
+	alice.Expect("No such rule set: calvinball")
+
+	alice.Write("new blitz\n")
+	alice.Expect("Now playing in game: ")
+	out := alice.Output()
+	start := strings.Index(out, "Now playing in game: ") + len("Now playing in game: ")
+	game := gm.Get(out[start : start+4])
+	if game == nil {
+		t.Fatalf("game was not registered with the game manager")
+	}
+	alice.Expect("You're in the staging room")
+	if game.rules.Name != "blitz" {
+		t.Fatalf("expected game to be played by blitz rules, got %q", game.rules.Name)
+	}
+}
@@ -2,123 +2,79 @@ package main
 
 import (
 	"fmt"
-	"time"
+	"sort"
 )
 
-type scan struct {
-	start         time.Time
-	origin        *System
-	dist          float64
-	nextHitIndex  int
-	nextEchoIndex int
-	results       []scanResult
-	neighborhood  Neighborhood
-}
-
-type scanResult struct {
-	system       *System
-	dist         float64
-	players      map[*Connection]bool
-	colonizedBy  *Connection
-	shielded     bool
-	shieldEnergy float64
-}
+// scanPing is the outbound half of a scan. When it reaches a system, the
+// inhabitants of that system are made aware that they've been scanned, and
+// an echo describing the system is sent back to the scan's origin.
+type scanPing struct{}
 
-func (r *scanResult) Empty() bool {
-	return (r.players == nil || len(r.players) == 0) && r.colonizedBy == nil
+func (e scanPing) Observe(g *Game, from, at *System, sent int64) {
+	at.EachConn(func(conn *Connection) {
+		conn.Emit(observationEvent{
+			Observed: "scan",
+			System:   *from.ref(),
+			Message:  fmt.Sprintf("scan detected from %v", from),
+		})
+	})
+	g.Send(at, from, scanEcho{result: newScanResult(at)})
 }
 
-func (r *scanResult) playerNames() []string {
-	if r.players == nil || len(r.players) == 0 {
-		return nil
-	}
-	names := make([]string, 0, len(r.players))
-	for conn := range r.players {
-		names = append(names, conn.Name())
-	}
-	return names
+// scanEcho is the return half of a scan: the state of a scanned system,
+// carried back to the origin of the scan at the speed of light.
+type scanEcho struct {
+	result scanResult
 }
 
-func NewScan(origin *System, n Neighborhood) *scan {
-	return &scan{
-		origin:       origin,
-		start:        time.Now(),
-		results:      make([]scanResult, 0, len(n)),
-		neighborhood: n,
+func (e scanEcho) Observe(g *Game, from, at *System, sent int64) {
+	res := e.result
+	log_info("echo from %v reached origin %v", from.name, at.name)
+	at.EachConn(func(conn *Connection) {
+		conn.intel.recordScan(res, sent)
+	})
+	if res.Empty() {
+		return
 	}
+	at.EachConn(func(conn *Connection) {
+		conn.Emit(scanResultEvent{
+			System:       *res.system.ref(),
+			Distance:     at.DistanceTo(res.system),
+			Shielded:     res.shielded,
+			ShieldEnergy: res.shieldEnergy,
+			Inhabitants:  res.players,
+			ColonizedBy:  res.colonizedBy,
+		})
+	})
 }
 
-func (s *scan) Tick(game *Game) {
-	s.dist += options.lightSpeed
-	s.hits(game)
-	s.echos()
-}
-
-func (s *scan) Dead() bool {
-	return s.neighborhood == nil
-}
-
-func (s *scan) String() string {
-	return fmt.Sprintf("[scan origin: %s start_time: %v]", s.origin.name, s.start)
-}
-
-func (s *scan) hits(game *Game) {
-	for len(s.neighborhood) > 0 && s.neighborhood[0].distance <= s.dist {
-		sys := game.galaxy.GetSystemByID(s.neighborhood[0].id)
-		s.results = append(s.results, s.hitSystem(sys, s.neighborhood[0].distance))
-		log_info("scan hit %v. Traveled %v in %v", sys.name, s.neighborhood[0].distance, time.Since(s.start))
-
-		if len(s.neighborhood) > 1 {
-			s.neighborhood = s.neighborhood[1:]
-		} else {
-			s.neighborhood = nil
-		}
-	}
+type scanResult struct {
+	system       *System
+	players      []string
+	colonizedBy  string
+	shielded     bool
+	shieldEnergy float64
 }
 
-func (s *scan) hitSystem(sys *System, dist float64) scanResult {
-	sys.NotifyInhabitants("scan detected from %v\n", s.origin)
+// newScanResult captures the current state of a system
+func newScanResult(sys *System) scanResult {
 	r := scanResult{
-		system:      sys,
-		colonizedBy: sys.colonizedBy,
-		dist:        dist * 2.0,
-		shielded:    sys.Shield != nil,
+		system:   sys,
+		shielded: sys.Shield != nil,
+	}
+	if sys.colonizedBy != nil {
+		r.colonizedBy = sys.colonizedBy.Name()
 	}
 	if sys.Shield != nil {
 		r.shieldEnergy = sys.Shield.energy
 	}
-	if sys.players != nil {
-		r.players = make(map[*Connection]bool, len(sys.players))
-		for k, v := range sys.players {
-			r.players[k] = v
-		}
-	}
+	sys.EachConn(func(conn *Connection) {
+		r.players = append(r.players, conn.Name())
+	})
+	sort.Strings(r.players)
 	return r
 }
 
-func (s *scan) echos() {
-	for ; s.nextEchoIndex < len(s.results); s.nextEchoIndex += 1 {
-		res := s.results[s.nextEchoIndex]
-		if s.dist < res.dist {
-			break
-		}
-		log_info("echo from %v reached origin %v after %v", res.system.name, s.origin.name, time.Since(s.start))
-		if res.Empty() {
-			continue
-		}
-		s.origin.NotifyInhabitants("results from scan of %v:\n", res.system)
-		s.origin.NotifyInhabitants("\tdistance: %v\n", s.origin.DistanceTo(res.system))
-		s.origin.NotifyInhabitants("\tshielded: %v\n", res.shielded)
-		if res.shielded {
-			s.origin.NotifyInhabitants("\tshield energy: %v\n", res.shieldEnergy)
-		}
-		inhabitants := res.playerNames()
-		if inhabitants != nil {
-			s.origin.NotifyInhabitants("\tinhabitants: %v\n", inhabitants)
-		}
-		if res.colonizedBy != nil {
-			s.origin.NotifyInhabitants("\tcolonized by: %v\n", res.colonizedBy.Name())
-		}
-
-	}
+func (r *scanResult) Empty() bool {
+	return len(r.players) == 0 && r.colonizedBy == ""
 }
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"container/heap"
+)
+
+// scheduledEvent is a callback that is to be run on a given frame.
+type scheduledEvent struct {
+	frame int64
+	seq   uint64 // keeps events that land on the same frame in FIFO order
+	fn    func(*Game)
+}
+
+// schedule is a priority queue of events, ordered by the frame on which they
+// are to fire. It implements heap.Interface and should only be manipulated
+// through the heap package.
+type schedule []*scheduledEvent
+
+func (s schedule) Len() int { return len(s) }
+
+func (s schedule) Less(i, j int) bool {
+	if s[i].frame == s[j].frame {
+		return s[i].seq < s[j].seq
+	}
+	return s[i].frame < s[j].frame
+}
+
+func (s schedule) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+func (s *schedule) Push(x interface{}) { *s = append(*s, x.(*scheduledEvent)) }
+
+func (s *schedule) Pop() interface{} {
+	old := *s
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*s = old[:n-1]
+	return e
+}
+
+// Schedule arranges for fn to be called on the game's goroutine during the
+// given frame. Events scheduled for a frame that has already passed are run
+// on the next frame.
+func (g *Game) Schedule(frame int64, fn func(*Game)) {
+	g.scheduleSeq += 1
+	heap.Push(&g.schedule, &scheduledEvent{frame: frame, seq: g.scheduleSeq, fn: fn})
+}
+
+// After arranges for fn to be called on the game's goroutine once the given
+// number of frames have elapsed.
+func (g *Game) After(frames int64, fn func(*Game)) {
+	g.Schedule(g.frame+frames, fn)
+}
+
+// runScheduled fires every event that is due on the current frame.
+func (g *Game) runScheduled() {
+	for len(g.schedule) > 0 && g.schedule[0].frame <= g.frame {
+		e := heap.Pop(&g.schedule).(*scheduledEvent)
+		e.fn(g)
+	}
+}
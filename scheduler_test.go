@@ -0,0 +1,61 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScheduleFiresOnItsFrame(t *testing.T) {
+	h := newHarness(t)
+	fired := make(map[string]int64)
+	record := func(name string) func(*Game) {
+		return func(g *Game) { fired[name] = g.frame }
+	}
+	h.game.Schedule(5, record("five"))
+	h.game.Schedule(3, record("three"))
+	h.game.After(8, record("after eight"))
+
+	h.Step(4)
+	if want := map[string]int64{"three": 3}; !reflect.DeepEqual(fired, want) {
+		t.Fatalf("after 4 frames, expected %v to have fired, got %v", want, fired)
+	}
+	h.Step(4)
+	if want := map[string]int64{"three": 3, "five": 5, "after eight": 8}; !reflect.DeepEqual(fired, want) {
+		t.Fatalf("after 8 frames, expected %v to have fired, got %v", want, fired)
+	}
+
+	// an event for a frame that's already gone by fires on the next one
+	h.game.Schedule(2, record("late"))
+	h.Step(1)
+	if fired["late"] != 9 {
+		t.Fatalf("expected the late event to fire on frame 9, it fired on %d", fired["late"])
+	}
+}
+
+func TestScheduleKeepsOrderWithinFrame(t *testing.T) {
+	h := newHarness(t)
+	var order []string
+	record := func(name string) func(*Game) {
+		return func(g *Game) { order = append(order, name) }
+	}
+	h.game.Schedule(3, record("first"))
+	h.game.Schedule(2, record("earlier frame"))
+	h.game.Schedule(3, record("second"))
+	h.game.After(3, record("third"))
+	h.game.Schedule(3, func(g *Game) {
+		order = append(order, "fourth")
+		// events can schedule more events
+		g.After(1, record("next frame"))
+	})
+	h.game.Schedule(3, record("fifth"))
+
+	h.Step(3)
+	want := []string{"earlier frame", "first", "second", "third", "fourth", "fifth"}
+	if !reflect.DeepEqual(order, want) {
+		t.Fatalf("events fired in the order %v, expected %v", order, want)
+	}
+	h.Step(1)
+	if want = append(want, "next frame"); !reflect.DeepEqual(order, want) {
+		t.Fatalf("events fired in the order %v, expected %v", order, want)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// newResumeToken creates a token with which a player can resume their seat in
+// a game. Tokens are drawn from the system's random source rather than the
+// game's seeded random number generator, since they must not be guessable
+// from the game's seed.
+func newResumeToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log_error("unable to create resume token: %v", err)
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// resumeToken extracts the token from a "resume [token]" line typed at the
+// name prompt.
+func resumeToken(line string) (string, bool) {
+	parts := strings.Fields(line)
+	if len(parts) != 2 || parts[0] != "resume" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// resumeSession logs a player in by the resume token of their seat, and hands
+// the seat back to them. It returns false if no game has a seat with that
+// token.
+func (c *Connection) resumeSession(token string) bool {
+	for _, game := range gm.List() {
+		profile := game.TokenOwner(token)
+		if profile == nil {
+			continue
+		}
+		log_info("player %s resumed their session in game %s", profile.name, game.id)
+		c.profile = profile
+		return joinGame(c, game)
+	}
+	c.Emit(errorEvent{Error: "unknown resume token"})
+	return false
+}
+
+// resumeSeat hands a player that has just logged in the seat they left
+// behind in a running game, if there is one.
+func (c *Connection) resumeSeat() bool {
+	game := seatedIn(c.profile.name)
+	if game == nil {
+		return false
+	}
+	c.Printf("You still have a seat in game %s.\n", game.id)
+	return joinGame(c, game)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+)
+
+// drop simulates a player's socket going away.
+func (h *harness) drop(cl *client) {
+	h.game.Submit(quitMessage{conn: cl.conn, link: cl.conn.link})
+}
+
+func TestDisconnectedShipCarriesOn(t *testing.T) {
+	h := newHarness(t)
+	alice := h.Join("alice", 1)
+	h.System(1).money = 1000
+	start := alice.conn.money
+
+	alice.Send("mine")
+	h.Step(1)
+	h.drop(alice)
+	h.Step(20)
+	if h.game.seatOf("alice") != alice.conn {
+		t.Fatalf("alice's seat was not kept after her socket went away")
+	}
+	if alice.conn.money <= start+1 {
+		t.Fatalf("alice's ship stopped mining while she was disconnected")
+	}
+}
+
+func TestDisconnectedSeatExpires(t *testing.T) {
+	h := newHarness(t)
+	alice := h.Join("alice", 1)
+	bob := h.Join("bob", 2)
+	h.drop(alice)
+	h.Step(1)
+	bob.Expect("Player alice has lost their connection")
+
+	h.Step(int(h.game.rules.frames(options.resumeGrace)) - 1)
+	if h.game.seatOf("alice") == nil {
+		t.Fatalf("alice's seat was removed before the grace period was over")
+	}
+	h.Step(1)
+	if h.game.seatOf("alice") != nil {
+		t.Fatalf("alice's seat was kept after the grace period was over")
+	}
+	if h.System(1).players[alice.conn] {
+		t.Fatalf("alice is still at %v after her seat expired", h.System(1))
+	}
+}
+
+func TestLoggingBackInResumesSeat(t *testing.T) {
+	name := uniqueName("gina")
+	gina := login(t, name, "password")
+	gina.Write("new\n")
+	gina.Write("start\n")
+	gina.Expect("you are in the system")
+	out := gina.Output()
+	start := strings.Index(out, "Now playing in game: ") + len("Now playing in game: ")
+	code := out[start : start+4]
+	gina.sock.Close()
+
+	again := newClient(t, name, func(sock net.Conn) *Connection {
+		go handleConnection(sock)
+		return nil
+	})
+	again.Expect("What is your name, adventurer?")
+	again.Write(name + "\n")
+	again.Write("password\n")
+	again.Expect("You still have a seat in game " + code)
+	again.Expect("Welcome back. You have reclaimed your seat")
+	again.Refute("Available Commands in state: Lobby")
+
+	again.Write("status\n")
+	again.Expect("Current Game:  " + code)
+}
+
+func TestJSONResumeToken(t *testing.T) {
+	name := uniqueName("resumebot")
+	connect := func() *client {
+		bot := newClient(t, name, func(sock net.Conn) *Connection {
+			go handleConnection(sock)
+			return nil
+		})
+		bot.Write(`{"protocol": "json"}` + "\n")
+		bot.Expect(`{"type":"prompt","prompt":"name"`)
+		return bot
+	}
+
+	bot := connect()
+	bot.Write(`{"line": "` + name + `"}` + "\n")
+	bot.Write(`{"line": "beepboop"}` + "\n")
+	bot.Write(`{"line": "beepboop"}` + "\n")
+	bot.Expect(`{"type":"state","state":"Lobby"}`)
+	bot.Write(`{"command": "new"}` + "\n")
+	bot.Write(`{"command": "start"}` + "\n")
+	bot.Expect(`{"type":"location"`)
+
+	var session struct {
+		Game  string `json:"game"`
+		Token string `json:"token"`
+	}
+	for _, line := range strings.Split(bot.Output(), "\n") {
+		if strings.HasPrefix(line, `{"type":"session",`) {
+			if err := json.Unmarshal([]byte(line), &session); err != nil {
+				t.Fatalf("unable to parse session event: %v", err)
+			}
+		}
+	}
+	if session.Token == "" {
+		t.Fatalf("session event had no token")
+	}
+	bot.sock.Close()
+
+	bot = connect()
+	bot.Write(`{"command": "resume", "args": ["not-a-token"]}` + "\n")
+	bot.Expect(`{"type":"error","error":"unknown resume token"}`)
+	bot.Write(`{"command": "resume", "args": ["` + session.Token + `"]}` + "\n")
+	bot.Expect("Welcome back. You have reclaimed your seat")
+	bot.Expect(`{"type":"session","game":"` + session.Game + `","token":"` + session.Token + `"}`)
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// gameSettings are the choices made by the player that starts a game: the
+// rules the game is played by, and who may join it.
+type gameSettings struct {
+	rules      Rules
+	maxPlayers int    // 0 means there's no limit
+	private    bool   // the player starting the game is to choose a password for it
+	password   []byte // hashed; nil for a public game
+}
+
+// gameOption is a setting that can be given to the new command as
+// name=value. The options are described in the new command's help.
+type gameOption struct {
+	name string
+	set  func(s *gameSettings, value string) error
+}
+
+var gameOptions = []gameOption{
+	{"players", func(s *gameSettings, v string) error {
+		n, err := atLeast(v, 1)
+		s.maxPlayers = n
+		return err
+	}},
+	{"money", func(s *gameSettings, v string) error {
+		n, err := atLeast(v, 0)
+		s.rules.StartMoney = n
+		return err
+	}},
+	{"bombs", func(s *gameSettings, v string) error {
+		n, err := atLeast(v, 0)
+		s.rules.StartBombs = n
+		return err
+	}},
+	{"size", func(s *gameSettings, v string) error {
+		n, err := atLeast(v, 2)
+		s.rules.GalaxySize = n
+		return err
+	}},
+	{"center", func(s *gameSettings, v string) error {
+		s.rules.Center = v
+		return nil
+	}},
+	{"radius", func(s *gameSettings, v string) error {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 {
+			return fmt.Errorf("must be a positive number")
+		}
+		s.rules.Radius = f
+		return nil
+	}},
+	{"shape", func(s *gameSettings, v string) error {
+		if v == "catalog" {
+			v = ""
+		}
+		s.rules.Shape = v
+		return nil
+	}},
+	{"stars", func(s *gameSettings, v string) error {
+		n, err := atLeast(v, 2)
+		s.rules.Stars = n
+		return err
+	}},
+	{"density", func(s *gameSettings, v string) error {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 {
+			return fmt.Errorf("must be a positive number")
+		}
+		s.rules.Density = f
+		return nil
+	}},
+	{"planets", func(s *gameSettings, v string) error {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 1 {
+			return fmt.Errorf("must be a number no less than 1")
+		}
+		s.rules.PlanetMean = f
+		return nil
+	}},
+	{"seed", func(s *gameSettings, v string) error {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q isn't a number", v)
+		}
+		s.rules.GalaxySeed = n
+		return nil
+	}},
+	{"frame-rate", func(s *gameSettings, v string) error {
+		n, err := atLeast(v, 1)
+		s.rules.FrameRate = n
+		return err
+	}},
+	{"wins", func(s *gameSettings, v string) error {
+		s.rules.Victories = strings.Split(v, ",")
+		return nil
+	}},
+}
+
+func atLeast(v string, min int) (int, error) {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%q isn't a number", v)
+	}
+	if n < min {
+		return 0, fmt.Errorf("must be at least %d", min)
+	}
+	return n, nil
+}
+
+func findGameOption(name string) *gameOption {
+	for i := range gameOptions {
+		if gameOptions[i].name == name {
+			return &gameOptions[i]
+		}
+	}
+	return nil
+}
+
+// parseGameSettings reads the arguments to the new command: an optional rule
+// set name, followed by any number of name=value options. "private" may be
+// given anywhere among them.
+func parseGameSettings(args []string) (gameSettings, error) {
+	var private bool
+	var rest []string
+	for _, arg := range args {
+		if arg == "private" {
+			private = true
+		} else {
+			rest = append(rest, arg)
+		}
+	}
+	args = rest
+
+	name := options.rules
+	if len(args) > 0 && !strings.Contains(args[0], "=") {
+		name, args = args[0], args[1:]
+	}
+	rules, err := lookupRules(name)
+	if err != nil {
+		return gameSettings{}, fmt.Errorf("No such rule set: %s. Choose one of: %s", name, strings.Join(ruleSetNames(), ", "))
+	}
+	s := gameSettings{rules: rules, private: private}
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if parts[0] == "password" {
+			// a password typed as an option would be echoed for anyone
+			// watching to see
+			return gameSettings{}, fmt.Errorf(`Passwords aren't given as options. Use "new private" and you'll be asked for one.`)
+		}
+		opt := findGameOption(parts[0])
+		if opt == nil || len(parts) != 2 {
+			return gameSettings{}, fmt.Errorf("Unknown game option: %s", arg)
+		}
+		if err := opt.set(&s, parts[1]); err != nil {
+			return gameSettings{}, fmt.Errorf("Bad value for %s: %v", opt.name, err)
+		}
+	}
+	if err := s.rules.validate(); err != nil {
+		return gameSettings{}, fmt.Errorf("Bad game options: %v", err)
+	}
+	// a generated galaxy doesn't exist until the game does, but a catalog can
+	// be checked for the center now
+	if c := s.rules.Center; c != "" && c != "cluster" && s.rules.Shape == "" {
+		sys, err := pickSystem(galaxySystems(nil, s.rules), c)
+		if err != nil {
+			return gameSettings{}, fmt.Errorf("Bad value for center: %v", err)
+		}
+		s.rules.Center = sys.name
+	}
+	return s, nil
+}
+
+// errPasswordNeeded turns away a player who hasn't given the password of a
+// private game, so that they can be asked for it.
+var errPasswordNeeded = errors.New("it needs a password")
+
+// admits checks whether a player may take a seat in the game. Players that
+// already have a seat are always let back in. unlocked is whether the player
+// has given the game's password, which is checked before the player asks to
+// be seated.
+func (g *Game) admits(name string, unlocked bool) error {
+	if g.seatOf(name) != nil {
+		return nil
+	}
+	if g.maxPlayers > 0 && len(g.connections) >= g.maxPlayers {
+		return fmt.Errorf("game %s is full", g.id)
+	}
+	if g.password != nil && !unlocked {
+		return fmt.Errorf("game %s is private: %w", g.id, errPasswordNeeded)
+	}
+	return nil
+}
+
+// unlocks checks a password against the game's. A game's password is set when
+// it's created and never changes, so this is safe to call from outside of the
+// game's goroutine, and it should be: bcrypt takes long enough to hold up a
+// frame.
+func (g *Game) unlocks(password string) bool {
+	return g.password == nil || bcrypt.CompareHashAndPassword(g.password, []byte(password)) == nil
+}
+
+// admitMessage seats a player in a game if the game admits them. Checking
+// and joining in a single message means that two players can't both take the
+// last seat.
+type admitMessage struct {
+	conn     *Connection
+	unlocked bool
+	reply    chan error
+}
+
+func (m admitMessage) Apply(g *Game) {
+	if err := g.admits(m.conn.Name(), m.unlocked); err != nil {
+		m.reply <- err
+		return
+	}
+	m.conn.Printf("You have joined game %s\n", g.id)
+	joinMessage{conn: m.conn}.Apply(g)
+	m.reply <- nil
+}
+
+// gameSummary describes a game for the list command. It's safe to call from
+// outside of the game's goroutine.
+type gameSummary struct {
+	players []string
+	max     int
+	private bool
+	started bool
+}
+
+func (g *Game) Summary() (gameSummary, bool) {
+	reply := make(chan gameSummary, 1)
+	ok := g.Submit(queryMessage(func(g *Game) {
+		s := gameSummary{max: g.maxPlayers, private: g.password != nil, started: g.started}
+		for conn := range g.connections {
+			s.players = append(s.players, conn.Name())
+		}
+		reply <- s
+	}))
+	if !ok {
+		return gameSummary{}, false
+	}
+	select {
+	case s := <-reply:
+		return s, true
+	case <-g.done:
+		return gameSummary{}, false
+	}
+}
+
+// describe lists the settings a game was started with, e.g. "blitz rules,
+// 2/4 players, private".
+func (s gameSummary) describe(r Rules) string {
+	parts := []string{r.Name + " rules"}
+	if s.max > 0 {
+		parts = append(parts, fmt.Sprintf("%d/%d players", len(s.players), s.max))
+	} else if len(s.players) == 1 {
+		parts = append(parts, "1 player")
+	} else {
+		parts = append(parts, fmt.Sprintf("%d players", len(s.players)))
+	}
+	if s.private {
+		parts = append(parts, "private")
+	}
+	if !s.started {
+		parts = append(parts, "waiting to start")
+	}
+	if base, err := lookupRules(r.Name); err == nil {
+		if r.StartMoney != base.StartMoney {
+			parts = append(parts, fmt.Sprintf("money=%d", r.StartMoney))
+		}
+		if r.StartBombs != base.StartBombs {
+			parts = append(parts, fmt.Sprintf("bombs=%d", r.StartBombs))
+		}
+		if r.Shape != base.Shape && r.Shape == "" {
+			parts = append(parts, "shape=catalog")
+		} else if r.Shape != base.Shape {
+			parts = append(parts, "shape="+r.Shape)
+		}
+		if r.Stars != base.Stars {
+			parts = append(parts, fmt.Sprintf("stars=%d", r.Stars))
+		}
+		if r.GalaxySize != base.GalaxySize {
+			parts = append(parts, fmt.Sprintf("size=%d", r.GalaxySize))
+		}
+		if r.Radius != base.Radius {
+			parts = append(parts, fmt.Sprintf("radius=%v", r.Radius))
+		}
+		if r.Center != base.Center {
+			parts = append(parts, "center="+r.Center)
+		}
+		if r.FrameRate != base.FrameRate {
+			parts = append(parts, fmt.Sprintf("frame-rate=%d", r.FrameRate))
+		}
+	}
+	if len(r.Victories) > 0 {
+		parts = append(parts, "wins="+strings.Join(r.Victories, ","))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestParseGameSettings(t *testing.T) {
+	s, err := parseGameSettings([]string{"blitz", "players=3", "money=42", "size=10", "wins=economic"})
+	if err != nil {
+		t.Fatalf("unable to parse game settings: %v", err)
+	}
+	if s.rules.Name != "blitz" || s.maxPlayers != 3 || s.rules.StartMoney != 42 || s.rules.GalaxySize != 10 {
+		t.Fatalf("game settings were parsed wrong: %+v", s)
+	}
+	if s.rules.canWin("military") || !s.rules.canWin("economic") {
+		t.Fatalf("expected only economic victories to be allowed, got %v", s.rules.Victories)
+	}
+
+	s, err = parseGameSettings([]string{"bombs=2"})
+	if err != nil {
+		t.Fatalf("unable to parse game settings: %v", err)
+	}
+	if s.rules.Name != options.rules || s.rules.StartBombs != 2 {
+		t.Fatalf("expected default rules with 2 bombs, got %+v", s.rules)
+	}
+
+	s, err = parseGameSettings([]string{"private", "blitz", "players=2"})
+	if err != nil {
+		t.Fatalf("unable to parse game settings: %v", err)
+	}
+	if !s.private || s.rules.Name != "blitz" || s.maxPlayers != 2 || s.password != nil {
+		t.Fatalf("expected a private blitz game for 2 with its password still to be chosen, got %+v", s)
+	}
+
+	for _, args := range [][]string{
+		{"password=hunter2"},
+		{"players=0"},
+		{"size=lots"},
+		{"wins=diplomatic"},
+		{"colour=red"},
+		{"classic", "players"},
+		{"frame-rate=1001"},
+		{"frame-rate=2000000000"},
+	} {
+		if _, err := parseGameSettings(args); err == nil {
+			t.Errorf("expected %v to be rejected", args)
+		}
+	}
+}
+
+func TestGalaxySize(t *testing.T) {
+	rules := defaultRules()
+	rules.GalaxySize = 3
+	g := newGalaxy(defaultTestGalaxy(), rand.New(rand.NewSource(1)), rules)
+	systems := g.Systems()
+	if len(systems) != 3 {
+		t.Fatalf("expected a galaxy of 3 systems, got %d", len(systems))
+	}
+	for _, sys := range systems {
+		if sys.name == "Far" {
+			t.Fatalf("the far away straggler is not among the 3 nearest systems of anything but itself")
+		}
+	}
+	for i := 0; i < 20; i++ {
+		for _, sys := range g.planSpawns(rand.New(rand.NewSource(int64(i))), 2, 0, nil) {
+			if g.GetSystemByID(sys.id) != sys {
+				t.Fatalf("spawned on %v, which isn't in the galaxy", sys)
+			}
+		}
+	}
+}
+
+func TestPrivateGames(t *testing.T) {
+	alice := login(t, uniqueName("alice"), "hunter2")
+	// a game's password is chosen at a prompt, like the join password below,
+	// rather than typed as an option
+	alice.Write("new players=2 password=letmein\n")
+	alice.Expect(`Use "new private"`)
+	alice.Write("new private players=2\n")
+	alice.Expect("Choose a password for the game:")
+	alice.Write("letmein\n")
+	alice.Expect("Type it again to confirm:")
+	alice.Write("letmein\n")
+	alice.Expect("Now playing in game: ")
+	out := alice.Output()
+	start := strings.Index(out, "Now playing in game: ") + len("Now playing in game: ")
+	code := out[start : start+4]
+	alice.Expect("You're in the staging room")
+
+	bob := login(t, uniqueName("bob"), "hunter2")
+	bob.Write("list\n")
+	bob.Expect(code + "     classic rules, 1/2 players, private, waiting to start")
+
+	bob.Write("join " + code + "\n")
+	bob.Expect("Game " + code + " is private. Password:")
+	bob.Write("guessing\n")
+	bob.Expect("wrong password for game " + code)
+	bob.Write("join " + code + "\n")
+	bob.Write("letmein\n")
+	bob.Expect("You have joined game " + code)
+
+	carol := login(t, uniqueName("carol"), "hunter2")
+	carol.Write("join " + code + "\n")
+	carol.Expect("game " + code + " is full")
+	carol.Refute("Password:")
+	carol.Write("status\n")
+	carol.Expect("Currently in the Lobby")
+}
@@ -2,19 +2,24 @@ package main
 
 import (
 	"fmt"
+	"time"
 )
 
 func MakeShield(c *Connection, s *System) {
-	m := &MakeShieldState{
+	c.SetState(newMakeShieldState(s))
+}
+
+func newMakeShieldState(s *System) *MakeShieldState {
+	return &MakeShieldState{
 		System: s,
 		CommandSuite: CommandSet{
 			balCommand,
+			intelCommand,
 			BroadcastCommand(s),
 			NearbyCommand(s),
 			playersCommand,
 		},
 	}
-	c.SetState(m)
 }
 
 type MakeShieldState struct {
@@ -31,7 +36,7 @@ func (m *MakeShieldState) Tick(c *Connection, frame int64) ConnectionState {
 	if m.start == 0 {
 		m.start = frame
 	}
-	if framesToDur(frame-m.start) >= options.makeShieldTime {
+	if c.game.rules.duration(frame-m.start) >= time.Duration(c.game.rules.MakeShieldTime) {
 		return Idle(m.System)
 	}
 	return m
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// listeners are the sockets accepting new players, which are closed as soon
+// as the server starts shutting down.
+var listeners struct {
+	sync.Mutex
+	closers []io.Closer
+	closed  bool
+}
+
+// addListener registers a listener to be closed when the server shuts down.
+func addListener(l io.Closer) {
+	listeners.Lock()
+	defer listeners.Unlock()
+	if listeners.closed {
+		l.Close()
+		return
+	}
+	listeners.closers = append(listeners.closers, l)
+}
+
+// closeListeners stops the server from accepting any more players.
+func closeListeners() {
+	listeners.Lock()
+	defer listeners.Unlock()
+	listeners.closed = true
+	for _, l := range listeners.closers {
+		if err := l.Close(); err != nil {
+			log_error("unable to close listener: %v", err)
+		}
+	}
+	listeners.closers = nil
+}
+
+// shutdownOnSignal waits for the process to be told to stop, and then shuts
+// the server down gracefully: no more players are let in, the players in
+// every game are given a countdown, and then every game is saved or finished
+// off before the database is closed. A second signal cuts the countdown
+// short.
+func shutdownOnSignal() {
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-c
+	log_info("received %v, shutting down", sig)
+	closeListeners()
+	countdown(options.shutdownCountdown, c)
+	gm.Shutdown()
+	if err := db.Close(); err != nil {
+		log_error("unable to close database: %v", err)
+	}
+	log_info("shutdown complete")
+	os.Exit(E_Ok)
+}
+
+// countdown announces the shutdown to every player at intervals until the
+// countdown runs out or the process is signalled again.
+func countdown(d time.Duration, interrupt <-chan os.Signal) {
+	for d > 0 {
+		gm.Announce(shutdownEvent{Seconds: int(d.Round(time.Second) / time.Second)})
+		wait := nextAnnouncement(d)
+		select {
+		case <-time.After(wait):
+			d -= wait
+		case sig := <-interrupt:
+			log_info("received %v, skipping the rest of the shutdown countdown", sig)
+			return
+		}
+	}
+}
+
+// nextAnnouncement is how long to wait before announcing the shutdown again,
+// given how long is left on the countdown. The countdown is announced every
+// ten seconds, then at five seconds, then every second.
+func nextAnnouncement(left time.Duration) time.Duration {
+	var next time.Duration
+	switch {
+	case left > 10*time.Second:
+		next = (left - 1) / (10 * time.Second) * (10 * time.Second)
+	case left > 5*time.Second:
+		next = 5 * time.Second
+	default:
+		next = (left - 1) / time.Second * time.Second
+	}
+	return left - next
+}
+
+// shutdownEvent warns players that the server is about to shut down.
+type shutdownEvent struct {
+	Seconds int `json:"seconds"`
+}
+
+func (e shutdownEvent) kind() string { return "shutdown" }
+
+func (e shutdownEvent) render(w io.Writer) {
+	fmt.Fprintf(w, "*** The server is shutting down in %ds. Your game will be saved. ***\n", e.Seconds)
+}
+
+// shutdownMessage stops a game because the server is shutting down.
+type shutdownMessage struct{}
+
+func (m shutdownMessage) Apply(g *Game) {
+	g.halt()
+}
+
+// halt stops the game for good on this run of the server. A game that still
+// has players is snapshotted, so that it can be restored when the server comes
+// back up; a game that nobody is playing any more, or that never began, is
+// ended. Every player is
+// disconnected.
+func (g *Game) halt() {
+	if g.over() {
+		return
+	}
+	if g.started && len(g.connections) > 0 {
+		if err := g.SaveSnapshot(); err != nil {
+			log_error("%v", err)
+		}
+		log_info("saved game %s on frame %d", g.id, g.frame)
+	} else {
+		g.end = g.clock.Now()
+		g.record(logEntry{Type: "end"})
+		if err := g.Store(); err != nil {
+			log_error("unable to store game %s: %v", g.id, err)
+		}
+		if err := g.DeleteSnapshot(); err != nil {
+			log_error("unable to delete snapshot of game %s: %v", g.id, err)
+		}
+		log_info("ended abandoned game %s on frame %d", g.id, g.frame)
+	}
+	g.log.Close()
+
+	for conn := range g.connections {
+		if g.started {
+			conn.Printf("The server is shutting down. Game %s has been saved; log back in to resume it once the server is back.\n", g.id)
+		} else {
+			conn.Printf("The server is shutting down. Game %s hadn't begun, so it has been called off.\n", g.id)
+		}
+		conn.Close()
+	}
+	close(g.done)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNextAnnouncement(t *testing.T) {
+	var announced []int
+	left := 30 * time.Second
+	for left > 0 {
+		announced = append(announced, int(left/time.Second))
+		left -= nextAnnouncement(left)
+	}
+	want := []int{30, 20, 10, 5, 4, 3, 2, 1}
+	if len(announced) != len(want) {
+		t.Fatalf("announced the countdown at %v, expected %v", announced, want)
+	}
+	for i := range want {
+		if announced[i] != want[i] {
+			t.Fatalf("announced the countdown at %v, expected %v", announced, want)
+		}
+	}
+}
+
+func TestHaltSavesGamesWithPlayers(t *testing.T) {
+	h := newHarness(t)
+	h.game.id = uniqueName("SAVE")
+	if err := h.game.Create(); err != nil {
+		t.Fatal(err)
+	}
+	alice := h.Join("alice", 1)
+	h.Step(10)
+
+	h.game.halt()
+	alice.Expect("The server is shutting down")
+	if !h.game.over() {
+		t.Fatalf("game is still running after being halted")
+	}
+
+	var frame int64
+	if err := db.QueryRow(`select frame from snapshots where game_id = ?`, h.game.id).Scan(&frame); err != nil {
+		t.Fatalf("no snapshot was saved for game %s: %v", h.game.id, err)
+	}
+	if frame != h.game.frame {
+		t.Fatalf("snapshot was taken on frame %d, expected %d", frame, h.game.frame)
+	}
+
+	// a halted game doesn't advance any further
+	h.Step(10)
+	if h.game.frame != frame {
+		t.Fatalf("halted game advanced to frame %d", h.game.frame)
+	}
+}
+
+func TestHaltEndsEmptyGames(t *testing.T) {
+	h := newHarness(t)
+	h.game.id = uniqueName("EMPTY")
+	if err := h.game.Create(); err != nil {
+		t.Fatal(err)
+	}
+	h.Step(10)
+	h.game.halt()
+
+	var end sql.NullString
+	if err := db.QueryRow(`select end from games where id = ?`, h.game.id).Scan(&end); err != nil {
+		t.Fatalf("unable to read game %s: %v", h.game.id, err)
+	}
+	if !end.Valid {
+		t.Fatalf("empty game %s was not ended", h.game.id)
+	}
+}
+
+func TestShutdownCountdownReachesPlayers(t *testing.T) {
+	bot := login(t, uniqueName("doomed"), "password")
+	bot.Write("new\n")
+	bot.Write("start\n")
+	bot.Expect("you are in the system")
+	out := bot.Output()
+	start := strings.Index(out, "Now playing in game: ") + len("Now playing in game: ")
+	game := gm.Get(out[start : start+4])
+
+	gm.Announce(shutdownEvent{Seconds: 10})
+	bot.Expect("*** The server is shutting down in 10s. Your game will be saved. ***")
+
+	game.Submit(shutdownMessage{})
+	<-game.done
+	bot.Expect("Game " + game.id + " has been saved")
+}
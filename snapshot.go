@@ -0,0 +1,534 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// gameSnapshot is everything needed to bring a game back to life after the
+// server has been restarted. Snapshots are stored as JSON in the snapshots
+// table.
+//
+// Callbacks waiting in a game's schedule are not captured; they only ever
+// carry notifications like "scanner ready", and the underlying timers are
+// kept on each player.
+type gameSnapshot struct {
+	Game       string           `json:"game"`
+	Seed       int64            `json:"seed"`
+	Rules      *Rules           `json:"rules,omitempty"`
+	MaxPlayers int              `json:"max_players,omitempty"`
+	Password   []byte           `json:"password,omitempty"`
+	Frame      int64            `json:"frame"`
+	Start      time.Time        `json:"start"`
+	Systems    []systemSnapshot `json:"systems"`
+	Players    []playerSnapshot `json:"players"`
+	Bombs      []bombSnapshot   `json:"bombs,omitempty"`
+	Signals    []signalSnapshot `json:"signals,omitempty"`
+}
+
+type systemSnapshot struct {
+	ID          int      `json:"id"`
+	Money       int64    `json:"money"`
+	Shield      *float64 `json:"shield,omitempty"`
+	ColonizedBy string   `json:"colonized_by,omitempty"`
+}
+
+type playerSnapshot struct {
+	Name     string          `json:"name"`
+	Token    string          `json:"token,omitempty"`
+	Money    int             `json:"money"`
+	Bombs    int             `json:"bombs"`
+	Kills    int             `json:"kills"`
+	NextBomb int64           `json:"next_bomb"`
+	NextScan int64           `json:"next_scan"`
+	State    stateSnapshot   `json:"state"`
+	Intel    []intelSnapshot `json:"intel,omitempty"`
+}
+
+// stateSnapshot describes a player's ConnectionState. Which of the fields
+// are meaningful depends on the kind of state.
+type stateSnapshot struct {
+	Kind      string  `json:"kind"`
+	System    int     `json:"system,omitempty"`
+	Dest      int     `json:"dest,omitempty"`
+	Travelled float64 `json:"travelled,omitempty"`
+	Start     int64   `json:"start,omitempty"`
+	Mined     int     `json:"mined,omitempty"`
+}
+
+type intelSnapshot struct {
+	System       int      `json:"system"`
+	Frame        int64    `json:"frame"`
+	Inhabitants  []string `json:"inhabitants,omitempty"`
+	ColonizedBy  string   `json:"colonized_by,omitempty"`
+	Shielded     bool     `json:"shielded,omitempty"`
+	ShieldEnergy float64  `json:"shield_energy,omitempty"`
+	LastBombed   int64    `json:"last_bombed,omitempty"`
+	LastMessage  string   `json:"last_message,omitempty"`
+}
+
+type bombSnapshot struct {
+	Bomber string `json:"bomber"`
+	Origin int    `json:"origin"`
+	Target int    `json:"target"`
+	Start  int64  `json:"start"`
+	FTI    int64  `json:"fti"`
+}
+
+// signalSnapshot is an event whose light is still making its way across the
+// galaxy.
+type signalSnapshot struct {
+	Origin    int           `json:"origin"`
+	Start     int64         `json:"start"`
+	Remaining []int         `json:"remaining"`
+	Event     eventSnapshot `json:"event"`
+}
+
+type eventSnapshot struct {
+	Kind    string        `json:"kind"`
+	Player  string        `json:"player,omitempty"`
+	Message string        `json:"message,omitempty"`
+	Scan    *scanSnapshot `json:"scan,omitempty"`
+}
+
+type scanSnapshot struct {
+	System       int      `json:"system"`
+	Players      []string `json:"players,omitempty"`
+	ColonizedBy  string   `json:"colonized_by,omitempty"`
+	Shielded     bool     `json:"shielded,omitempty"`
+	ShieldEnergy float64  `json:"shield_energy,omitempty"`
+}
+
+func snapshotsTable() {
+	stmnt := `create table if not exists snapshots (
+        game_id text not null primary key,
+        frame integer not null,
+        taken text not null,
+        data text not null
+    );`
+	if _, err := db.Exec(stmnt); err != nil {
+		log_error("couldn't create snapshots table: %v", err)
+	}
+}
+
+// Snapshot captures the current state of the game. It must be called on the
+// game's goroutine.
+func (g *Game) Snapshot() *gameSnapshot {
+	snap := &gameSnapshot{
+		Game:       g.id,
+		Seed:       g.seed,
+		Rules:      &g.rules,
+		MaxPlayers: g.maxPlayers,
+		Password:   g.password,
+		Frame:      g.frame,
+		Start:      g.start,
+	}
+	for _, sys := range g.galaxy.Systems() {
+		s := systemSnapshot{ID: sys.id, Money: sys.money}
+		if sys.Shield != nil {
+			energy := sys.Shield.energy
+			s.Shield = &energy
+		}
+		if sys.colonizedBy != nil {
+			s.ColonizedBy = sys.colonizedBy.Name()
+		}
+		snap.Systems = append(snap.Systems, s)
+	}
+	for _, elem := range g.elems {
+		switch e := elem.(type) {
+		case *Connection:
+			snap.Players = append(snap.Players, e.snapshot())
+		case *Bomb:
+			var bomber string
+			if e.profile != nil {
+				bomber = e.profile.Name()
+			}
+			snap.Bombs = append(snap.Bombs, bombSnapshot{
+				Bomber: bomber,
+				Origin: e.origin.id,
+				Target: e.target.id,
+				Start:  e.start,
+				FTI:    e.fti,
+			})
+		case *propagation:
+			if sig, ok := e.snapshot(); ok {
+				snap.Signals = append(snap.Signals, sig)
+			}
+		}
+	}
+	return snap
+}
+
+func (c *Connection) snapshot() playerSnapshot {
+	p := playerSnapshot{
+		Name:     c.Name(),
+		Token:    c.token,
+		Money:    c.money,
+		Bombs:    c.bombs,
+		Kills:    c.kills,
+		NextBomb: c.nextBomb,
+		NextScan: c.nextScan,
+		State:    snapshotState(c.ConnectionState),
+	}
+	for _, r := range c.intel {
+		p.Intel = append(p.Intel, intelSnapshot{
+			System:       r.system.id,
+			Frame:        r.frame,
+			Inhabitants:  r.inhabitantNames(),
+			ColonizedBy:  r.colonizedBy,
+			Shielded:     r.shielded,
+			ShieldEnergy: r.shieldEnergy,
+			LastBombed:   r.lastBombed,
+			LastMessage:  r.lastMessage,
+		})
+	}
+	return p
+}
+
+func snapshotState(s ConnectionState) stateSnapshot {
+	switch st := s.(type) {
+	case *IdleState:
+		return stateSnapshot{Kind: "idle", System: st.System.id}
+	case *MiningState:
+		return stateSnapshot{Kind: "mining", System: st.System.id, Mined: st.mined}
+	case *TravelState:
+		return stateSnapshot{Kind: "travel", System: st.start.id, Dest: st.dest.id, Travelled: st.travelled}
+	case *MakeBombState:
+		return stateSnapshot{Kind: "make-bomb", System: st.System.id, Start: st.start}
+	case *MakeColonyState:
+		return stateSnapshot{Kind: "make-colony", System: st.System.id, Start: st.start}
+	case *MakeShieldState:
+		return stateSnapshot{Kind: "make-shield", System: st.System.id, Start: st.start}
+	case *DeadState:
+		return stateSnapshot{Kind: "dead", Start: st.start}
+	default:
+		// anything else is treated as the player having died, so that
+		// they're respawned when the game is restored.
+		return stateSnapshot{Kind: "dead"}
+	}
+}
+
+func (p *propagation) snapshot() (signalSnapshot, bool) {
+	var ev eventSnapshot
+	switch e := p.event.(type) {
+	case broadcastEvent:
+		ev = eventSnapshot{Kind: "broadcast", Message: e.message}
+	case scanPing:
+		ev = eventSnapshot{Kind: "scan-ping"}
+	case scanEcho:
+		ev = eventSnapshot{Kind: "scan-echo", Scan: &scanSnapshot{
+			System:       e.result.system.id,
+			Players:      e.result.players,
+			ColonizedBy:  e.result.colonizedBy,
+			Shielded:     e.result.shielded,
+			ShieldEnergy: e.result.shieldEnergy,
+		}}
+	case arrivalEvent:
+		ev = eventSnapshot{Kind: "arrival", Player: e.player}
+	case departureEvent:
+		ev = eventSnapshot{Kind: "departure", Player: e.player}
+	case colonyEvent:
+		ev = eventSnapshot{Kind: "colony", Player: e.owner}
+	case bombingEvent:
+		ev = eventSnapshot{Kind: "bombing"}
+	default:
+		log_error("unable to snapshot event of type %T", p.event)
+		return signalSnapshot{}, false
+	}
+	rest := p.neighborhood.rest()
+	remaining := make([]int, len(rest))
+	for i, n := range rest {
+		remaining[i] = n.id
+	}
+	return signalSnapshot{Origin: p.origin.id, Start: p.start, Remaining: remaining, Event: ev}, true
+}
+
+// SaveSnapshot writes a snapshot of the game to the database, replacing any
+// earlier snapshot of the same game. It must be called on the game's
+// goroutine.
+func (g *Game) SaveSnapshot() error {
+	data, err := json.Marshal(g.Snapshot())
+	if err != nil {
+		return fmt.Errorf("unable to encode snapshot of game %s: %v", g.id, err)
+	}
+	_, err = db.Exec(`
+        insert or replace into snapshots
+        (game_id, frame, taken, data)
+        values
+        (?, ?, ?, ?)
+    ;`, g.id, g.frame, time.Now(), string(data))
+	if err != nil {
+		return fmt.Errorf("unable to store snapshot of game %s: %v", g.id, err)
+	}
+	return nil
+}
+
+// DeleteSnapshot removes the stored snapshot of a game, e.g. because the game
+// is over.
+func (g *Game) DeleteSnapshot() error {
+	_, err := db.Exec(`delete from snapshots where game_id = ?`, g.id)
+	return err
+}
+
+// scheduleSnapshots saves a snapshot of the game every snapshot interval.
+func (g *Game) scheduleSnapshots() {
+	frames := g.rules.frames(options.snapshotInterval)
+	if frames <= 0 {
+		return
+	}
+	var save func(*Game)
+	save = func(g *Game) {
+		if err := g.SaveSnapshot(); err != nil {
+			log_error("%v", err)
+		}
+		g.After(frames, save)
+	}
+	g.After(frames, save)
+}
+
+// loadSnapshots reads every stored snapshot of a game that hasn't ended.
+func loadSnapshots() ([]*gameSnapshot, error) {
+	rows, err := db.Query(`
+        select snapshots.data
+        from snapshots
+        join games on games.id = snapshots.game_id
+        where games.end is null
+    ;`)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query snapshots: %v", err)
+	}
+	defer rows.Close()
+
+	var snaps []*gameSnapshot
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("unable to read snapshot row: %v", err)
+		}
+		var snap gameSnapshot
+		if err := json.Unmarshal([]byte(data), &snap); err != nil {
+			log_error("skipping unreadable snapshot: %v", err)
+			continue
+		}
+		snaps = append(snaps, &snap)
+	}
+	return snaps, rows.Err()
+}
+
+// restoreGame rebuilds a game from a snapshot. Every player in the snapshot
+// is given a vacant seat: their ship carries on in the state it was in, and
+// the player can reclaim it by joining the game under the same name.
+func restoreGame(snap *gameSnapshot, clock Clock) (*Game, error) {
+	return restoreGameWith(snap, clock, NewGalaxy)
+}
+
+// restoreGameWith is restoreGame for a game whose galaxy is built by the given
+// function, as with newGame.
+func restoreGameWith(snap *gameSnapshot, clock Clock, mkGalaxy func(*rand.Rand, Rules) *Galaxy) (*Game, error) {
+	// snapshots taken before games carried their own rules are restored
+	// with the server's default rules.
+	rules := defaultRules()
+	if snap.Rules != nil {
+		rules = *snap.Rules
+	}
+	g := newGame(snap.Seed, clock, rules, mkGalaxy)
+	if g.id != snap.Game {
+		return nil, fmt.Errorf("seed %d produced game %s, expected %s", snap.Seed, g.id, snap.Game)
+	}
+	g.started = true
+	g.maxPlayers = snap.MaxPlayers
+	g.password = snap.Password
+	g.frame = snap.Frame
+	g.start = snap.Start
+	// the random number generator's state can't be captured, so a restored
+	// game continues on a fresh sequence derived from its seed.
+	g.rng = rand.New(rand.NewSource(snap.Seed ^ snap.Frame))
+
+	system := func(id int) (*System, error) {
+		sys := g.galaxy.GetSystemByID(id)
+		if sys == nil {
+			return nil, fmt.Errorf("snapshot of game %s refers to unknown system %d", snap.Game, id)
+		}
+		return sys, nil
+	}
+
+	players := make(map[string]*Connection, len(snap.Players))
+	for _, p := range snap.Players {
+		conn := newConnection(nil)
+		profile, err := loadProfile(p.Name)
+		if err != nil {
+			profile = &Profile{name: p.Name}
+		}
+		conn.profile = profile
+		conn.game = g
+		conn.token = p.Token
+		conn.detachedAt = snap.Frame
+		conn.money = p.Money
+		conn.bombs = p.Bombs
+		conn.kills = p.Kills
+		conn.nextBomb = p.NextBomb
+		conn.nextScan = p.NextScan
+		for _, i := range p.Intel {
+			sys, err := system(i.System)
+			if err != nil {
+				return nil, err
+			}
+			r := &intelReport{
+				system:       sys,
+				frame:        i.Frame,
+				inhabitants:  make(map[string]bool, len(i.Inhabitants)),
+				colonizedBy:  i.ColonizedBy,
+				shielded:     i.Shielded,
+				shieldEnergy: i.ShieldEnergy,
+				lastBombed:   i.LastBombed,
+				lastMessage:  i.LastMessage,
+			}
+			for _, name := range i.Inhabitants {
+				r.inhabitants[name] = true
+			}
+			conn.intel[sys.id] = r
+		}
+		state, err := restoreState(p.State, &g.rules, system)
+		if err != nil {
+			return nil, err
+		}
+		conn.ConnectionState = state
+		if sys := conn.Location(); sys != nil {
+			if sys.players == nil {
+				sys.players = make(map[*Connection]bool, 8)
+			}
+			sys.players[conn] = true
+		}
+		g.connections[conn] = true
+		g.Register(conn)
+		players[p.Name] = conn
+	}
+
+	for _, s := range snap.Systems {
+		sys, err := system(s.ID)
+		if err != nil {
+			return nil, err
+		}
+		sys.money = s.Money
+		if s.Shield != nil {
+			sys.Shield = &Shield{energy: *s.Shield}
+		}
+		sys.colonizedBy = players[s.ColonizedBy]
+	}
+
+	for _, b := range snap.Bombs {
+		origin, err := system(b.Origin)
+		if err != nil {
+			return nil, err
+		}
+		target, err := system(b.Target)
+		if err != nil {
+			return nil, err
+		}
+		g.Register(&Bomb{
+			profile: players[b.Bomber],
+			origin:  origin,
+			target:  target,
+			start:   b.Start,
+			fti:     b.FTI,
+		})
+	}
+
+	for _, sig := range snap.Signals {
+		origin, err := system(sig.Origin)
+		if err != nil {
+			return nil, err
+		}
+		event, err := restoreEvent(sig.Event, system)
+		if err != nil {
+			return nil, err
+		}
+		var remaining Neighborhood
+		for _, id := range sig.Remaining {
+			sys, err := system(id)
+			if err != nil {
+				return nil, err
+			}
+			remaining = append(remaining, Neighbor{id: id, distance: origin.DistanceTo(sys)})
+		}
+		p := &propagation{origin: origin, start: sig.Start, event: event, neighborhood: &remaining}
+		g.Register(p)
+	}
+	return g, nil
+}
+
+func restoreState(s stateSnapshot, rules *Rules, system func(int) (*System, error)) (ConnectionState, error) {
+	if s.Kind == "dead" {
+		return &DeadState{start: s.Start, CommandSuite: CommandSet{}}, nil
+	}
+	sys, err := system(s.System)
+	if err != nil {
+		return nil, err
+	}
+	switch s.Kind {
+	case "idle":
+		return Idle(sys), nil
+	case "mining":
+		m := Mine(sys).(*MiningState)
+		m.mined = s.Mined
+		return m, nil
+	case "travel":
+		dest, err := system(s.Dest)
+		if err != nil {
+			return nil, err
+		}
+		t := newTravelState(rules, sys, dest)
+		t.travelled = s.Travelled
+		return t, nil
+	case "make-bomb":
+		m := MakeBomb(sys).(*MakeBombState)
+		m.start = s.Start
+		return m, nil
+	case "make-colony":
+		m := newMakeColonyState(sys)
+		m.start = s.Start
+		return m, nil
+	case "make-shield":
+		m := newMakeShieldState(sys)
+		m.start = s.Start
+		return m, nil
+	default:
+		return nil, fmt.Errorf("unknown state kind in snapshot: %q", s.Kind)
+	}
+}
+
+func restoreEvent(e eventSnapshot, system func(int) (*System, error)) (Event, error) {
+	switch e.Kind {
+	case "broadcast":
+		return broadcastEvent{message: e.Message}, nil
+	case "scan-ping":
+		return scanPing{}, nil
+	case "scan-echo":
+		if e.Scan == nil {
+			return nil, fmt.Errorf("scan echo in snapshot is missing its results")
+		}
+		sys, err := system(e.Scan.System)
+		if err != nil {
+			return nil, err
+		}
+		return scanEcho{result: scanResult{
+			system:       sys,
+			players:      e.Scan.Players,
+			colonizedBy:  e.Scan.ColonizedBy,
+			shielded:     e.Scan.Shielded,
+			shieldEnergy: e.Scan.ShieldEnergy,
+		}}, nil
+	case "arrival":
+		return arrivalEvent{player: e.Player}, nil
+	case "departure":
+		return departureEvent{player: e.Player}, nil
+	case "colony":
+		return colonyEvent{owner: e.Player}, nil
+	case "bombing":
+		return bombingEvent{}, nil
+	default:
+		return nil, fmt.Errorf("unknown event kind in snapshot: %q", e.Kind)
+	}
+}
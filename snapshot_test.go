@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestRestoreTravellingPlayer(t *testing.T) {
+	h := newHarness(t)
+	alice := h.Join("alice", 1)
+	alice.Send("goto 3")
+	h.Step(10)
+
+	restored := h.Restore()
+	seat := restored.game.seatOf("alice")
+	if seat == nil {
+		t.Fatalf("alice's seat was not restored")
+	}
+	travel, ok := seat.ConnectionState.(*TravelState)
+	if !ok {
+		t.Fatalf("expected alice to be travelling after the restore, she is %v", seat.ConnectionState)
+	}
+	original := alice.conn.ConnectionState.(*TravelState)
+	if travel.dest != restored.System(3) || travel.travelled != original.travelled {
+		t.Fatalf("alice's journey was restored wrong: %v, %v travelled of %v", travel, travel.travelled, original.travelled)
+	}
+
+	// Alpha and Gamma are two parsecs apart.
+	frames := int(2/(h.game.rules.PlayerSpeed*h.game.rules.LightSpeed)) - 10
+	h.Step(frames)
+	restored.Step(frames)
+	if alice.conn.Location() != h.System(3) {
+		t.Fatalf("expected alice to have arrived at Gamma, she is %v", alice.conn.ConnectionState)
+	}
+	if seat.Location() != restored.System(3) || !restored.System(3).players[seat] {
+		t.Fatalf("expected the restored alice to have arrived at Gamma, she is %v", seat.ConnectionState)
+	}
+}
+
+// gameState is a snapshot of a game in a form that can be compared with
+// another game's: everything in it is in a fixed order.
+func gameState(g *Game) string {
+	snap := g.Snapshot()
+	sort.Slice(snap.Players, func(i, j int) bool { return snap.Players[i].Name < snap.Players[j].Name })
+	for i, p := range snap.Players {
+		// resume tokens are random, and handed out afresh when a game is
+		// replayed
+		snap.Players[i].Token = ""
+		sort.Slice(p.Intel, func(i, j int) bool { return p.Intel[i].System < p.Intel[j].System })
+	}
+	sort.Slice(snap.Bombs, func(i, j int) bool {
+		a, b := snap.Bombs[i], snap.Bombs[j]
+		if a.Start != b.Start {
+			return a.Start < b.Start
+		}
+		return a.Bomber < b.Bomber
+	})
+	sort.SliceStable(snap.Signals, func(i, j int) bool {
+		a, b := snap.Signals[i], snap.Signals[j]
+		if a.Start != b.Start {
+			return a.Start < b.Start
+		}
+		return a.Origin < b.Origin
+	})
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+// expectRestored checks that a game restored from a snapshot carries on
+// exactly as the original does, comparing the two after each number of
+// frames.
+func expectRestored(t *testing.T, h *harness, steps ...int) *harness {
+	t.Helper()
+	restored := h.Restore()
+	for i := -1; i < len(steps); i++ {
+		if i >= 0 {
+			h.Step(steps[i])
+			restored.Step(steps[i])
+		}
+		if want, got := gameState(h.game), gameState(restored.game); want != got {
+			t.Fatalf("restored game differs from the original on frame %d.\noriginal:\n%s\nrestored:\n%s", h.game.frame, want, got)
+		}
+	}
+	return restored
+}
+
+func TestSnapshotIdleAndMining(t *testing.T) {
+	h := newHarness(t)
+	h.Join("alice", 1)
+	bob := h.Join("bob", 2)
+	h.System(2).money = 50
+
+	bob.Send("mine")
+	h.Step(10)
+	restored := expectRestored(t, h, 1, 20, 30)
+
+	seat := restored.game.seatOf("bob")
+	if _, ok := seat.ConnectionState.(*IdleState); !ok || seat.money != bob.conn.money {
+		t.Fatalf("expected the restored bob to have mined Beta out, he is %v with %d", seat.ConnectionState, seat.money)
+	}
+	if restored.System(2).money != 0 {
+		t.Fatalf("expected the restored Beta to be mined out, it has %d", restored.System(2).money)
+	}
+	if seat := restored.game.seatOf("alice"); seat.Location() != restored.System(1) || !restored.System(1).players[seat] {
+		t.Fatalf("expected the restored alice to be idle on Alpha, she is %v", seat.ConnectionState)
+	}
+}
+
+func TestSnapshotTravel(t *testing.T) {
+	h := newHarness(t)
+	alice := h.Join("alice", 1)
+	h.Join("bob", 4)
+
+	alice.Send("goto 2")
+	h.Step(40)
+	// alice arrives at Beta, and news of her arrival reaches bob on Delta
+	expectRestored(t, h, 1, 50, 100, 200)
+}
+
+func TestSnapshotBuilding(t *testing.T) {
+	h := newHarness(t)
+	alice := h.Join("alice", 1)
+	bob := h.Join("bob", 2)
+	carol := h.Join("carol", 3)
+	rules := h.game.rules
+	alice.conn.money = rules.BombCost
+	bob.conn.money = rules.ColonyCost
+
+	alice.Send("make bomb")
+	bob.Send("make colony")
+	carol.Send("make shield")
+	h.Step(100)
+	if _, ok := carol.conn.ConnectionState.(*MakeShieldState); !ok {
+		t.Fatalf("expected carol to be making a shield, she is %v", carol.conn.ConnectionState)
+	}
+
+	bomb, colony, shield := int(rules.frames(time.Duration(rules.MakeBombTime))), int(rules.frames(time.Duration(rules.MakeColonyTime))), int(rules.frames(time.Duration(rules.MakeShieldTime)))
+	restored := expectRestored(t, h, 1, bomb-100, colony-bomb, shield-colony+1, 200)
+
+	if seat := restored.game.seatOf("alice"); seat.bombs != rules.StartBombs+1 {
+		t.Fatalf("expected the restored alice to have finished her bomb, she has %d", seat.bombs)
+	}
+	if restored.System(2).colonizedBy != restored.game.seatOf("bob") {
+		t.Fatalf("expected the restored bob to have colonized Beta")
+	}
+	if restored.System(3).Shield == nil {
+		t.Fatalf("expected the restored carol to have shielded Gamma")
+	}
+}
+
+func TestSnapshotBombsAndDeath(t *testing.T) {
+	h := newHarness(t)
+	alice := h.Join("alice", 1)
+	bob := h.Join("bob", 2)
+	alice.conn.bombs = 1
+
+	alice.Send("bomb 2")
+	h.Step(20)
+	if len(h.game.Snapshot().Bombs) != 1 {
+		t.Fatalf("expected alice's bomb to be in flight")
+	}
+
+	// the bomb lands on bob a parsec away, and word of it gets back to alice
+	flight := int(1 / (h.game.rules.LightSpeed * h.game.rules.BombSpeed))
+	restored := expectRestored(t, h, 1, flight-20, 1, 120)
+	if _, ok := bob.conn.ConnectionState.(*DeadState); !ok {
+		t.Fatalf("expected bob to be dead, he is %v", bob.conn.ConnectionState)
+	}
+	if seat := restored.game.seatOf("alice"); seat.kills != 1 {
+		t.Fatalf("expected the restored alice to have killed bob, she has %d kills", seat.kills)
+	}
+
+	// bob stays dead across another restore
+	restored = expectRestored(t, h, 1, 100)
+	if _, ok := restored.game.seatOf("bob").ConnectionState.(*DeadState); !ok {
+		t.Fatalf("expected the restored bob to be dead, he is %v", restored.game.seatOf("bob").ConnectionState)
+	}
+}
+
+func TestSnapshotSignals(t *testing.T) {
+	h := newHarness(t)
+	alice := h.Join("alice", 1)
+	h.Join("bob", 3)
+
+	alice.Send("broadcast hello out there")
+	alice.Send("scan")
+	h.Step(50)
+	inFlight := make(map[string]bool)
+	for _, sig := range h.game.Snapshot().Signals {
+		inFlight[sig.Event.Kind] = true
+	}
+	if !inFlight["broadcast"] || !inFlight["scan-ping"] {
+		t.Fatalf("expected a broadcast and a scan to be in flight, there are %v", inFlight)
+	}
+
+	// the broadcast and the scan reach bob on Gamma, and the echo of the
+	// scan makes its way back to alice
+	restored := expectRestored(t, h, 1, 150, 200, 100)
+	seat := restored.game.seatOf("alice")
+	r, ok := seat.intel[3]
+	if !ok || !r.inhabitants["bob"] {
+		t.Fatalf("expected the restored alice to have learned that bob is on Gamma, she knows %v", seat.intel)
+	}
+	if r := restored.game.seatOf("bob").intel[1]; r == nil || r.lastMessage != "hello out there" {
+		t.Fatalf("expected the restored bob to have heard alice's broadcast, he knows %v", r)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+const (
+	// spawnAttempts is how many plans are drawn up, each from a different
+	// random first system, before the fairest one is picked. Only a galaxy
+	// with nobody in it yet has a random first system; a plan built around
+	// players already in the galaxy always comes out the same, so only one is
+	// drawn up.
+	spawnAttempts = 8
+
+	// refinePasses is how many times each spawn in a plan is moved to where
+	// it's farthest from the others.
+	refinePasses = 2
+
+	// spawnSlack is how much closer than the farthest candidate a system may
+	// be and still be chosen, so that a better balance of resources can be
+	// found.
+	spawnSlack = 0.8
+
+	// localRadius is the distance, in parsecs, within which a system's money
+	// counts towards the resources available to a player spawned near it.
+	localRadius = 15
+)
+
+// planSpawns picks n systems to place players on. Players are kept as far
+// apart as possible: each plan is built by repeatedly choosing the system
+// whose nearest placed player is farthest away, and the plan in which the
+// closest pair of players is farthest apart wins. Since light travels at the
+// same speed everywhere, this also maximizes the light-time between players.
+// No two players are placed closer than minDist unless the galaxy leaves no
+// other choice, and among systems that are nearly as far away as each other,
+// the one with the most typical amount of money nearby is preferred, so that
+// nobody starts out richer than anybody else. Systems in occupied are treated
+// as if players had already been placed on them.
+func (g *Galaxy) planSpawns(rng *rand.Rand, n int, minDist float64, occupied []*System) []*System {
+	systems := g.Systems()
+	if n <= 0 || len(systems) == 0 {
+		return nil
+	}
+	wealth := g.localWealth()
+	target := median(wealth)
+
+	attempts := spawnAttempts
+	if len(occupied) > 0 {
+		attempts = 1
+	}
+	var best []*System
+	bestDist, bestSpread := -1.0, math.Inf(1)
+	for attempt := 0; attempt < attempts; attempt++ {
+		plan := greedySpawns(rng, systems, wealth, target, n, minDist, occupied)
+		dist, spread := closestPair(plan, occupied), wealthSpread(plan, systems, wealth)
+		if dist > bestDist/spawnSlack || (dist >= bestDist*spawnSlack && spread < bestSpread) {
+			best, bestDist, bestSpread = plan, dist, spread
+		}
+	}
+	return best
+}
+
+// greedySpawns builds a single spawn plan.
+func greedySpawns(rng *rand.Rand, systems []*System, wealth []float64, target float64, n int, minDist float64, occupied []*System) []*System {
+	placed := append([]*System{}, occupied...)
+	taken := make(map[*System]bool, n)
+	plan := make([]*System, 0, n)
+	for len(plan) < n {
+		var pick int
+		if len(placed) == 0 {
+			pick = typicalSystem(rng, wealth)
+		} else {
+			pick = farthestFair(systems, wealth, target, minDist, placed, taken)
+		}
+		sys := systems[pick]
+		plan = append(plan, sys)
+		placed = append(placed, sys)
+		taken[sys] = true
+		if len(taken) == len(systems) {
+			// more players than systems; start sharing
+			taken = make(map[*System]bool, n)
+		}
+	}
+	if len(plan)+len(occupied) < 2 || n > len(systems) {
+		return plan
+	}
+
+	// the first system was picked without regard to the others, and early
+	// picks can box later ones in, so each spawn is placed again as far as
+	// possible from all of the others.
+	for pass := 0; pass < refinePasses; pass++ {
+		for i := range plan {
+			others := append([]*System{}, occupied...)
+			taken := make(map[*System]bool, n)
+			for j, sys := range plan {
+				if j != i {
+					others = append(others, sys)
+					taken[sys] = true
+				}
+			}
+			plan[i] = systems[farthestFair(systems, wealth, target, minDist, others, taken)]
+		}
+	}
+	return plan
+}
+
+// typicalSystem picks a random system from those whose nearby money is
+// neither in the richest nor in the poorest quarter.
+func typicalSystem(rng *rand.Rand, wealth []float64) int {
+	order := make([]int, len(wealth))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return wealth[order[i]] < wealth[order[j]] })
+	lo, hi := len(order)/4, len(order)-len(order)/4
+	return order[lo+rng.Intn(hi-lo)]
+}
+
+// farthestFair picks the system that's farthest from every placed player,
+// preferring a typical amount of money nearby among those that are nearly as
+// far.
+func farthestFair(systems []*System, wealth []float64, target, minDist float64, placed []*System, taken map[*System]bool) int {
+	dist := make([]float64, len(systems))
+	farthest := 0.0
+	for i, sys := range systems {
+		dist[i] = -1
+		if taken[sys] {
+			continue
+		}
+		dist[i] = math.Inf(1)
+		for _, other := range placed {
+			dist[i] = math.Min(dist[i], sys.DistanceTo(other))
+		}
+		farthest = math.Max(farthest, dist[i])
+	}
+	threshold := math.Max(minDist, farthest*spawnSlack)
+	if threshold > farthest {
+		threshold = farthest
+	}
+	pick := -1
+	for i := range systems {
+		if dist[i] < 0 || dist[i] < threshold {
+			continue
+		}
+		if pick < 0 || math.Abs(wealth[i]-target) < math.Abs(wealth[pick]-target) {
+			pick = i
+		}
+	}
+	return pick
+}
+
+// localWealth totals the money within localRadius of each system, in the
+// order of Systems.
+func (g *Galaxy) localWealth() []float64 {
+	systems := g.Systems()
+	wealth := make([]float64, len(systems))
+	for i, sys := range systems {
+		g.index.eachWithin(sys, localRadius, func(other *System, _ float64) {
+			wealth[i] += float64(other.money)
+		})
+	}
+	return wealth
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	return sorted[len(sorted)/2]
+}
+
+// closestPair is the distance between the two closest players in a plan,
+// including players already in the galaxy.
+func closestPair(plan, occupied []*System) float64 {
+	all := append(append([]*System{}, occupied...), plan...)
+	closest := math.Inf(1)
+	for i := range all {
+		for j := i + 1; j < len(all); j++ {
+			closest = math.Min(closest, all[i].DistanceTo(all[j]))
+		}
+	}
+	return closest
+}
+
+// wealthSpread is the difference between the richest and the poorest start
+// in a plan.
+func wealthSpread(plan, systems []*System, wealth []float64) float64 {
+	index := make(map[*System]int, len(systems))
+	for i, sys := range systems {
+		index[sys] = i
+	}
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, sys := range plan {
+		w := wealth[index[sys]]
+		lo, hi = math.Min(lo, w), math.Max(hi, w)
+	}
+	return hi - lo
+}
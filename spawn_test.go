@@ -0,0 +1,111 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// testGalaxy builds a galaxy over the given systems in which every system
+// has the same amount of money.
+func testGalaxy(systems []*System) *Galaxy {
+	g := newGalaxy(systems, rand.New(rand.NewSource(1)), defaultRules())
+	for _, sys := range systems {
+		sys.money = 1000
+	}
+	return g
+}
+
+func TestSpawnsAreSpreadOut(t *testing.T) {
+	g := testGalaxy(defaultTestGalaxy())
+	for seed := int64(0); seed < 10; seed++ {
+		plan := g.planSpawns(rand.New(rand.NewSource(seed)), 2, 0, nil)
+		if len(plan) != 2 {
+			t.Fatalf("expected 2 spawns, got %d", len(plan))
+		}
+		if plan[0].name != "Far" && plan[1].name != "Far" {
+			t.Fatalf("expected one player to be sent to the far away system, got %v and %v", plan[0], plan[1])
+		}
+	}
+}
+
+func TestSpawnsRespectMinimumDistance(t *testing.T) {
+	var systems []*System
+	for i := 0; i < 100; i++ {
+		systems = append(systems, testSystem(i+1, "", float64(i%10), float64(i/10), 0))
+	}
+	g := testGalaxy(systems)
+	plan := g.planSpawns(rand.New(rand.NewSource(1)), 4, 8, nil)
+	for i := range plan {
+		for j := i + 1; j < len(plan); j++ {
+			if d := plan[i].DistanceTo(plan[j]); d < 8 {
+				t.Fatalf("%v and %v are only %.1f parsecs apart", plan[i], plan[j], d)
+			}
+		}
+	}
+}
+
+func TestRespawnAvoidsOtherPlayers(t *testing.T) {
+	g := testGalaxy(defaultTestGalaxy())
+	rng := rand.New(rand.NewSource(1))
+	if sys := g.planSpawns(rng, 1, 0, []*System{g.GetSystemByName("Alpha")})[0]; sys.name != "Far" {
+		t.Fatalf("expected a respawn away from Alpha to be on Far, got %v", sys)
+	}
+	if sys := g.planSpawns(rng, 1, 0, []*System{g.GetSystemByName("Far")})[0]; sys.name == "Far" {
+		t.Fatalf("respawned on top of another player")
+	}
+}
+
+func TestRespawnIsNotRandom(t *testing.T) {
+	var systems []*System
+	for i := 0; i < 100; i++ {
+		systems = append(systems, testSystem(i+1, "", float64(i%10), float64(i/10), 0))
+	}
+	g := testGalaxy(systems)
+	occupied := []*System{g.GetSystemByID(1), g.GetSystemByID(55)}
+
+	rng := rand.New(rand.NewSource(1))
+	want := g.planSpawns(rng, 3, 0, occupied)
+	for seed := int64(2); seed < 10; seed++ {
+		got := g.planSpawns(rand.New(rand.NewSource(seed)), 3, 0, occupied)
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("seed %d placed players on %v, seed 1 on %v", seed, got, want)
+			}
+		}
+	}
+	// and the game's random numbers are left for something else
+	if rng.Int63() != rand.New(rand.NewSource(1)).Int63() {
+		t.Fatalf("planning spawns around other players drew random numbers")
+	}
+}
+
+func TestSpawnsBalanceResources(t *testing.T) {
+	systems := []*System{
+		testSystem(1, "Home", 0, 0, 0),
+		testSystem(2, "Rich", 100, 0, 0),
+		testSystem(3, "Mine", 101, 0, 0),
+		testSystem(4, "Plain", 0, 100, 0),
+		testSystem(5, "Poor", -100, 0, 0),
+	}
+	g := testGalaxy(systems)
+	g.GetSystemByName("Mine").money = 50000
+	g.GetSystemByName("Poor").money = 0
+
+	sys := g.planSpawns(rand.New(rand.NewSource(1)), 1, 0, []*System{g.GetSystemByName("Home")})[0]
+	if sys.name != "Plain" {
+		t.Fatalf("expected the spawn with a typical amount of money nearby, got %v", sys)
+	}
+}
+
+func TestRespawnUsesPlanner(t *testing.T) {
+	h := newHarness(t)
+	alice := h.Join("alice", 1)
+	bob := h.Join("bob", 2)
+	bob.conn.SetState(NewDeadState(h.game.frame))
+	h.StepFor(time.Duration(h.game.rules.RespawnTime))
+	h.Step(2)
+	if sys := bob.conn.Location(); sys == nil || sys.name != "Far" {
+		t.Fatalf("expected bob to respawn on Far, away from alice on %v, got %v", alice.conn.Location(), sys)
+	}
+}
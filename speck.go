@@ -2,57 +2,115 @@ package main
 
 import (
 	"bufio"
+	"fmt"
 	"io"
-	"regexp"
+	"math"
 	"strconv"
 	"strings"
 )
 
-func speckStream(r io.ReadCloser, c chan System) {
-	defer close(c)
-	defer r.Close()
-	keep := regexp.MustCompile(`^\s*[\d-]`)
+// parsecToLightYears is the number of light years in a parsec, the unit that
+// speck files give distances in.
+const parsecToLightYears = 3.26156
 
-	br := bufio.NewReader(r)
-	for {
-		line, err := br.ReadBytes('\n')
-		switch err {
-		case io.EOF:
-			return
-		case nil:
-			break
-		default:
-			log_error("unable to stream speck file: %v", err)
-			return
-		}
-		if !keep.Match(line) {
+// speckFormat reads the speck files of the AMNH Digital Universe Atlas, e.g.
+// expl.speck. Each system is a line of the form:
+//
+//	x y z [datavars...] # name
+//
+// with its position in parsecs. The datavar lines in the file's header name
+// the columns after the position; numplanets gives the number of planets and
+// distance, if there is one, the distance from the Sun in light years, which
+// has to agree with the position.
+type speckFormat struct{}
+
+func (speckFormat) readCatalog(r io.Reader) ([]System, error) {
+	var (
+		systems  []System
+		errs     catalogErrors
+		datavars = make(map[string]int)
+		line     int
+	)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() && !errs.full() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
 			continue
 		}
-		planet := parseSpeckLine(line)
-		c <- *planet
-
+		fields := strings.Fields(text)
+		if fields[0] == "datavar" {
+			if len(fields) != 3 {
+				errs.add(line, fmt.Errorf("expected datavar <column> <name>"))
+				continue
+			}
+			col, err := strconv.Atoi(fields[1])
+			if err != nil || col < 0 {
+				errs.add(line, fmt.Errorf("bad datavar column %q", fields[1]))
+				continue
+			}
+			datavars[fields[2]] = col
+			continue
+		}
+		if !strings.ContainsAny(text[:1], "0123456789-+.") {
+			// some other header directive, e.g. texture
+			continue
+		}
+		s, err := parseSpeckLine(text, datavars)
+		if err == nil {
+			err = checkSystem(s)
+		}
+		errs.add(line, err)
+		systems = append(systems, s)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read speck file: %v", err)
 	}
+	return systems, errs.err()
 }
 
-func parseSpeckLine(line []byte) *System {
-	parts := strings.Split(string(line), " ")
-	var err error
-	var g errorGroup
-	s := new(System)
-
-	s.x, err = strconv.ParseFloat(parts[0], 64)
-	g.AddError(err)
-	s.y, err = strconv.ParseFloat(parts[1], 64)
-	g.AddError(err)
-	s.z, err = strconv.ParseFloat(parts[2], 64)
-	g.AddError(err)
-	s.planets, err = strconv.Atoi(parts[3])
-	g.AddError(err)
+// parseSpeckLine parses a single system, given the columns named in the
+// file's datavars.
+func parseSpeckLine(line string, datavars map[string]int) (System, error) {
+	var s System
+	data, name, ok := strings.Cut(line, "#")
+	if !ok {
+		return s, fmt.Errorf("missing # before the system's name")
+	}
+	s.name = strings.TrimSpace(name)
 
-	s.name = strings.TrimSpace(strings.Join(parts[7:], " "))
+	fields := strings.Fields(data)
+	columns := 3
+	for _, col := range datavars {
+		if 4+col > columns {
+			columns = 4 + col
+		}
+	}
+	if len(fields) < columns {
+		return s, fmt.Errorf("expected %d columns, found %d", columns, len(fields))
+	}
+	var err error
+	for i, v := range []*float64{&s.x, &s.y, &s.z} {
+		if *v, err = strconv.ParseFloat(fields[i], 64); err != nil {
+			return s, fmt.Errorf("bad coordinate %q", fields[i])
+		}
+	}
 
-	if g != nil {
-		log_error("unable to parse speck line: %v", g)
+	s.planets = 1
+	if col, ok := datavars["numplanets"]; ok {
+		if s.planets, err = strconv.Atoi(fields[3+col]); err != nil {
+			return s, fmt.Errorf("bad number of planets %q", fields[3+col])
+		}
+	}
+	if col, ok := datavars["distance"]; ok {
+		ly, err := strconv.ParseFloat(fields[3+col], 64)
+		if err != nil {
+			return s, fmt.Errorf("bad distance %q", fields[3+col])
+		}
+		pos := math.Sqrt(sq(s.x)+sq(s.y)+sq(s.z)) * parsecToLightYears
+		if math.Abs(pos-ly) > 0.01*ly+0.2 {
+			return s, fmt.Errorf("distance of %.1f light years doesn't agree with the position, which is %.1f light years away", ly, pos)
+		}
 	}
-	return s
+	return s, nil
 }
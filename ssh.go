@@ -0,0 +1,313 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// keyHolder is implemented by transports that have authenticated their
+// player with a public key.
+type keyHolder interface {
+	publicKey() ssh.PublicKey
+}
+
+// sshConn adapts an ssh session to the net.Conn interface, so that ssh
+// players are handled by the same Connection type as telnet players. If the
+// player's client asked for a terminal, input is read a line at a time through
+// a terminal emulator that handles echo and line editing, since the player's
+// own terminal is in raw mode.
+type sshConn struct {
+	ssh.Channel
+	server   *ssh.ServerConn
+	key      ssh.PublicKey
+	protocol protocol
+	term     *term.Terminal // nil if the client didn't ask for a terminal
+	noEcho   bool
+	r        io.Reader
+
+	mu   sync.Mutex // guards cols
+	cols int
+}
+
+func (c *sshConn) publicKey() ssh.PublicKey         { return c.key }
+func (c *sshConn) handshakeProtocol() protocol      { return c.protocol }
+func (c *sshConn) LocalAddr() net.Addr              { return c.server.LocalAddr() }
+func (c *sshConn) RemoteAddr() net.Addr             { return c.server.RemoteAddr() }
+func (c *sshConn) SetDeadline(time.Time) error      { return nil }
+func (c *sshConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *sshConn) SetWriteDeadline(time.Time) error { return nil }
+
+func (c *sshConn) setEcho(on bool) { c.noEcho = !on }
+
+func (c *sshConn) width() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cols
+}
+
+// resize records the size of the player's terminal.
+func (c *sshConn) resize(cols, rows uint32) {
+	c.mu.Lock()
+	c.cols = int(cols)
+	c.mu.Unlock()
+	if c.term != nil {
+		c.term.SetSize(int(cols), int(rows))
+	}
+}
+
+func (c *sshConn) Read(b []byte) (int, error) {
+	if c.term == nil {
+		return c.Channel.Read(b)
+	}
+	for c.r == nil {
+		var line string
+		var err error
+		if c.noEcho {
+			line, err = c.term.ReadPassword("")
+		} else {
+			line, err = c.term.ReadLine()
+		}
+		if err != nil {
+			return 0, err
+		}
+		c.r = strings.NewReader(line + "\n")
+	}
+	n, err := c.r.Read(b)
+	if err == io.EOF {
+		c.r = nil
+		err = nil
+	}
+	return n, err
+}
+
+func (c *sshConn) Write(b []byte) (int, error) {
+	if c.term == nil {
+		return c.Channel.Write(b)
+	}
+	return c.term.Write(b)
+}
+
+// Close ends the player's ssh session. The client hangs up the ssh connection
+// itself once its session is over.
+func (c *sshConn) Close() error {
+	c.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+	return c.Channel.Close()
+}
+
+// keyLogin logs in a player that connected over ssh. Keys that belong to a
+// profile are logged straight in; a new key is offered the chance to register
+// a new profile.
+func (c *Connection) keyLogin(key ssh.PublicKey) bool {
+	profile, err := loadProfileByKey(key)
+	if err == nil {
+		log_info("player connected with key: %v", profile.name)
+		c.profile = profile
+		c.Printf("Welcome back, %s.\n", profile.name)
+		return true
+	}
+
+	c.Printf("your key (%s) isn't registered yet.\n", ssh.FingerprintSHA256(key))
+	c.Printf("pick a name and a password; the password lets you log in without your key.\n")
+	for {
+		c.Emit(promptEvent{Prompt: "name", Text: "Pick a name to register it under:"})
+		name, err := c.readLine()
+		if err != nil {
+			log_error("player failed to register key: %v", err)
+			return false
+		}
+		if !ValidName(name) {
+			c.Printf("that name is illegal.\n")
+			continue
+		}
+		if _, err := loadProfile(name); err == nil {
+			c.Printf("the name %s is already taken.\n", name)
+			continue
+		}
+		password, ok := c.choosePassword("Choose a password:")
+		if !ok {
+			return false
+		}
+		profile := &Profile{name: name}
+		if profile.password, err = hashPassword(password); err != nil {
+			log_error("unable to hash password: %v", err)
+			return false
+		}
+		if err := profile.Create(); err != nil {
+			log_error("unable to create profile record: %v", err)
+			c.Printf("unable to register that name.\n")
+			continue
+		}
+		if err := profile.AddKey(key); err != nil {
+			log_error("unable to register key: %v", err)
+		}
+		log_info("player registered key: %v", name)
+		c.profile = profile
+		c.Printf("you look new around these parts, %s.\n", profile.name)
+		c.Printf(`if you'd like a description of how to play, type the "help" command\n`)
+		return true
+	}
+}
+
+// sshConfig creates the configuration for the ssh server. Any public key is
+// accepted: keys are matched up to profiles once the player is in the lobby.
+func sshConfig(hostKey ssh.Signer) *ssh.ServerConfig {
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			return &ssh.Permissions{
+				Extensions: map[string]string{"pubkey": string(key.Marshal())},
+			}, nil
+		},
+	}
+	config.AddHostKey(hostKey)
+	return config
+}
+
+// loadHostKey reads the server's ssh host key, generating one if it doesn't
+// exist yet.
+func loadHostKey(path string) (ssh.Signer, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		log_info("generating ssh host key at %s", path)
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("unable to generate host key: %v", err)
+		}
+		block, err := ssh.MarshalPrivateKey(priv, "exo host key")
+		if err != nil {
+			return nil, fmt.Errorf("unable to encode host key: %v", err)
+		}
+		b = pem.EncodeToMemory(block)
+		if err := ioutil.WriteFile(path, b, 0600); err != nil {
+			return nil, fmt.Errorf("unable to write host key: %v", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read host key: %v", err)
+	}
+	signer, err := ssh.ParsePrivateKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse host key: %v", err)
+	}
+	return signer, nil
+}
+
+// serveSSH runs the ssh protocol on a newly accepted socket. Each session
+// opened on the connection is a player. Players get the text protocol, unless
+// they run the json command, e.g.:
+//
+//	ssh -p 9222 exo.example.com json
+func serveSSH(nc net.Conn, config *ssh.ServerConfig) {
+	server, chans, reqs, err := ssh.NewServerConn(nc, config)
+	if err != nil {
+		log_error("ssh handshake with %v failed: %v", nc.RemoteAddr(), err)
+		return
+	}
+	log_info("ssh connection from %v", server.RemoteAddr())
+	go ssh.DiscardRequests(reqs)
+
+	key, err := ssh.ParsePublicKey([]byte(server.Permissions.Extensions["pubkey"]))
+	if err != nil {
+		log_error("unable to parse key for %v: %v", server.RemoteAddr(), err)
+		server.Close()
+		return
+	}
+
+	for nch := range chans {
+		if nch.ChannelType() != "session" {
+			nch.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		ch, reqs, err := nch.Accept()
+		if err != nil {
+			log_error("unable to accept ssh session from %v: %v", server.RemoteAddr(), err)
+			continue
+		}
+		go serveSession(&sshConn{Channel: ch, server: server, key: key}, reqs)
+	}
+}
+
+// serveSession handles the requests made on an ssh session, starting the
+// player's Connection once the client asks for a shell or a command.
+func serveSession(conn *sshConn, reqs <-chan *ssh.Request) {
+	started := false
+	for req := range reqs {
+		switch {
+		case req.Type == "pty-req" && !started:
+			var pty struct {
+				Term                      string
+				Cols, Rows, Width, Height uint32
+				Modes                     string
+			}
+			if err := ssh.Unmarshal(req.Payload, &pty); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			conn.term = term.NewTerminal(conn.Channel, "")
+			conn.resize(pty.Cols, pty.Rows)
+			req.Reply(true, nil)
+		case req.Type == "window-change":
+			var size struct{ Cols, Rows, Width, Height uint32 }
+			if err := ssh.Unmarshal(req.Payload, &size); err == nil {
+				conn.resize(size.Cols, size.Rows)
+			}
+			req.Reply(true, nil)
+		case req.Type == "shell" && !started:
+			started = true
+			req.Reply(true, nil)
+			go handleConnection(conn)
+		case req.Type == "exec" && !started:
+			var cmd struct{ Command string }
+			if err := ssh.Unmarshal(req.Payload, &cmd); err != nil || cmd.Command != "json" {
+				req.Reply(false, nil)
+				continue
+			}
+			started = true
+			conn.protocol = jsonProtocol
+			req.Reply(true, nil)
+			go handleConnection(conn)
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+// listenSSH serves ssh clients on the given address.
+func listenSSH(addr string) {
+	hostKey, err := loadHostKey(options.sshHostKey)
+	if err != nil {
+		log_error("unable to start ssh server: %v", err)
+		return
+	}
+	config := sshConfig(hostKey)
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log_error("unable to start ssh server: %v", err)
+		return
+	}
+	addListener(listener)
+	log_info("listening for ssh on %s", addr)
+	for {
+		nc, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log_error("error accepting ssh connection: %v", err)
+			continue
+		}
+		go serveSSH(nc, config)
+	}
+}
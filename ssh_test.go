@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// sshServer starts an ssh server for the duration of a test, returning its
+// address.
+func sshServer(t *testing.T) string {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate host key: %v", err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("unable to create host key signer: %v", err)
+	}
+	config := sshConfig(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			nc, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSH(nc, config)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func newUserKey(t *testing.T) ssh.Signer {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate user key: %v", err)
+	}
+	key, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("unable to create user key signer: %v", err)
+	}
+	return key
+}
+
+// sshSession is a player connected over ssh.
+type sshSession struct {
+	t     *testing.T
+	stdin io.Writer
+	mu    sync.Mutex
+	out   bytes.Buffer
+}
+
+func (s *sshSession) Write(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.out.Write(b)
+}
+
+func (s *sshSession) Send(line string) {
+	if _, err := s.stdin.Write([]byte(line + "\n")); err != nil {
+		s.t.Fatalf("unable to write to ssh session: %v", err)
+	}
+}
+
+func (s *sshSession) Expect(text string) {
+	s.t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		s.mu.Lock()
+		found := strings.Contains(s.out.String(), text)
+		s.mu.Unlock()
+		if found {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.t.Fatalf("timed out waiting for %q, have:\n%s", text, s.out.String())
+}
+
+func (s *sshSession) Refute(text string) {
+	s.t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if strings.Contains(s.out.String(), text) {
+		s.t.Fatalf("unexpected %q in output:\n%s", text, s.out.String())
+	}
+}
+
+// dialSSH opens a shell on the ssh server, authenticating with key.
+func dialSSH(t *testing.T, addr string, key ssh.Signer) *sshSession {
+	client, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            "player",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(key)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatalf("unable to dial ssh: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatalf("unable to open ssh session: %v", err)
+	}
+	s := &sshSession{t: t}
+	session.Stdout = s
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		t.Fatalf("unable to open stdin: %v", err)
+	}
+	s.stdin = stdin
+	if err := session.Shell(); err != nil {
+		t.Fatalf("unable to start shell: %v", err)
+	}
+	return s
+}
+
+func TestSSHKeyRegistration(t *testing.T) {
+	addr := sshServer(t)
+	key := newUserKey(t)
+	name := uniqueName("keyholder")
+
+	first := dialSSH(t, addr, key)
+	first.Expect("isn't registered yet")
+	first.Send(name)
+	first.Send("hunter2")
+	first.Send("hunter2")
+	first.Expect("you look new around these parts, " + name)
+
+	second := dialSSH(t, addr, key)
+	second.Expect("Welcome back, " + name)
+	second.Refute("What is your name")
+	second.Refute("isn't registered yet")
+}
+
+func TestSSHRegistrationRefusesTakenNames(t *testing.T) {
+	addr := sshServer(t)
+	name := uniqueName("taken")
+	owner := dialSSH(t, addr, newUserKey(t))
+	owner.Expect("isn't registered yet")
+	owner.Send(name)
+	owner.Send("hunter2")
+	owner.Send("hunter2")
+	owner.Expect("you look new around these parts")
+
+	thief := dialSSH(t, addr, newUserKey(t))
+	thief.Expect("isn't registered yet")
+	thief.Send(name)
+	thief.Expect("the name " + name + " is already taken")
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// StagingState is the state of a player waiting in a game's staging room. A
+// game doesn't begin until its host starts it, so that nobody gets a head
+// start: until then, players can see who else has joined, chat, and say
+// whether they're ready.
+type StagingState struct {
+	CommandSuite
+	NopExit
+	ready bool
+}
+
+func Staging() ConnectionState {
+	s := &StagingState{}
+	s.CommandSuite = CommandSet{
+		Command{
+			name:    "players",
+			summary: "lists the players waiting for the game to start",
+			handler: s.players,
+		},
+		Command{
+			name:    "ready",
+			summary: "toggles whether you're ready to start",
+			handler: s.toggleReady,
+		},
+		Command{
+			name:    "start",
+			summary: "starts the countdown to the game, once everyone is ready",
+			handler: s.start,
+		},
+		Command{
+			name:     "say",
+			summary:  "says something to the other players",
+			usage:    "say [message]",
+			variadic: true,
+			handler:  s.say,
+		},
+	}
+	return s
+}
+
+func (s *StagingState) String() string { return "Staging" }
+
+func (s *StagingState) Enter(c *Connection) {
+	c.Printf("You're in the staging room of game %s. The game begins once %s starts it.\n", c.game.id, c.game.host)
+	c.Printf(`Type "ready" when you're ready to play.` + "\n")
+}
+
+func (s *StagingState) Tick(c *Connection, frame int64) ConnectionState { return s }
+
+func (st *StagingState) FillStatus(c *Connection, s *status) {
+	ready := "not ready"
+	if st.ready {
+		ready = "ready"
+	}
+	s.Description = fmt.Sprintf("Waiting for game %s to start. You are %s; the host is %s.", c.game.id, ready, c.game.host)
+}
+
+func (s *StagingState) players(c *Connection, args ...string) {
+	for _, other := range c.game.stagingPlayers() {
+		flags := []string{}
+		if other.Name() == c.game.host {
+			flags = append(flags, "host")
+		}
+		if st, ok := other.ConnectionState.(*StagingState); ok && st.ready {
+			flags = append(flags, "ready")
+		}
+		c.Printf("%-20s %s\n", other.Name(), strings.Join(flags, ", "))
+	}
+}
+
+func (s *StagingState) toggleReady(c *Connection, args ...string) {
+	s.ready = !s.ready
+	for other := range c.game.connections {
+		if s.ready {
+			other.Printf("%s is ready.\n", c.Name())
+		} else {
+			other.Printf("%s is no longer ready.\n", c.Name())
+		}
+	}
+	if !s.ready {
+		c.game.cancelCountdown(fmt.Sprintf("%s is no longer ready", c.Name()))
+	}
+}
+
+func (s *StagingState) start(c *Connection, args ...string) {
+	g := c.game
+	if c.Name() != g.host {
+		c.Printf("Only the host, %s, can start the game.\n", g.host)
+		return
+	}
+	if !g.startAt.IsZero() {
+		c.Printf("The countdown has already started.\n")
+		return
+	}
+	s.ready = true
+	var waiting []string
+	for _, other := range g.stagingPlayers() {
+		if st, ok := other.ConnectionState.(*StagingState); ok && !st.ready {
+			waiting = append(waiting, other.Name())
+		}
+	}
+	if len(waiting) > 0 {
+		c.Printf("Still waiting for: %s\n", strings.Join(waiting, ", "))
+		return
+	}
+	if g.rules.StartCountdown <= 0 {
+		g.begin()
+		return
+	}
+	log_info("countdown to game %s started", g.id)
+	g.startAt = g.clock.Now().Add(time.Duration(g.rules.StartCountdown))
+	g.announced = 0
+	g.stage()
+}
+
+func (s *StagingState) say(c *Connection, args ...string) {
+	msg := strings.Join(args, " ")
+	for other := range c.game.connections {
+		if other != c {
+			other.Printf("[%s] %s\n", c.Name(), msg)
+		}
+	}
+}
+
+// stagingPlayers lists the players in the game, in order of name.
+func (g *Game) stagingPlayers() []*Connection {
+	players := make([]*Connection, 0, len(g.connections))
+	for conn := range g.connections {
+		players = append(players, conn)
+	}
+	sort.Slice(players, func(i, j int) bool { return players[i].Name() < players[j].Name() })
+	return players
+}
+
+// stage runs the staging room on each tick of a game that hasn't begun,
+// counting down to the start of the game once the host has started it.
+func (g *Game) stage() {
+	if g.startAt.IsZero() {
+		return
+	}
+	left := g.startAt.Sub(g.clock.Now())
+	if left <= 0 {
+		g.begin()
+		return
+	}
+	seconds := int((left + time.Second - 1) / time.Second)
+	if seconds != g.announced {
+		g.announced = seconds
+		for conn := range g.connections {
+			conn.Emit(countdownEvent{Seconds: seconds})
+		}
+	}
+}
+
+// cancelCountdown stops the countdown to the start of the game, if it's
+// running.
+func (g *Game) cancelCountdown(reason string) {
+	if g.started || g.startAt.IsZero() {
+		return
+	}
+	g.startAt = time.Time{}
+	for conn := range g.connections {
+		conn.Printf("The countdown has been cancelled: %s.\n", reason)
+	}
+}
+
+// leaveStaging removes a player that has left a game before it began. If the
+// host leaves, the next player in line becomes the host.
+func (g *Game) leaveStaging(conn *Connection) {
+	g.Quit(conn)
+	g.cancelCountdown(fmt.Sprintf("%s has left", conn.Name()))
+	if conn.Name() != g.host {
+		return
+	}
+	g.host = ""
+	if players := g.stagingPlayers(); len(players) > 0 {
+		g.host = players[0].Name()
+		for other := range g.connections {
+			other.Printf("%s has left; %s is now the host.\n", conn.Name(), g.host)
+		}
+	}
+}
+
+// begin starts the game. Every player is placed at the same moment, by the
+// spawn planner, so that nobody gets a better start than anybody else.
+func (g *Game) begin() {
+	if g.started {
+		return
+	}
+	g.started = true
+	g.startAt = time.Time{}
+	g.record(logEntry{Type: "begin"})
+	log_info("game %s has begun", g.id)
+
+	players := g.stagingPlayers()
+	spawns := g.galaxy.planSpawns(g.rng, len(players), g.rules.SpawnDistance, nil)
+	for i, conn := range players {
+		conn.Printf("The game has begun!\n")
+		conn.SetState(Idle(spawns[i]))
+	}
+}
+
+// countdownEvent counts down to the start of a game.
+type countdownEvent struct {
+	Seconds int `json:"seconds"`
+}
+
+func (e countdownEvent) kind() string { return "countdown" }
+
+func (e countdownEvent) render(w io.Writer) {
+	fmt.Fprintf(w, "The game begins in %d...\n", e.Seconds)
+}
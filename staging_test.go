@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// newStagingHarness starts a game that's still in its staging room.
+func newStagingHarness(t *testing.T) *harness {
+	h := newHarness(t)
+	h.game.started = false
+	return h
+}
+
+// Stage adds a player to the game's staging room.
+func (h *harness) Stage(name string) *client {
+	h.t.Helper()
+	cl := newClient(h.t, name, newConnection)
+	cl.conn.profile = &Profile{name: name}
+	cl.conn.game = h.game
+	h.game.Submit(joinMessage{conn: cl.conn})
+	h.Step(1)
+	return cl
+}
+
+func TestStagingCountdown(t *testing.T) {
+	h := newStagingHarness(t)
+	h.game.rules.StartCountdown = duration(3 * time.Second)
+	alice := h.Stage("alice")
+	bob := h.Stage("bob")
+	alice.Expect("Player bob has joined the game")
+
+	bob.Send("say hello there")
+	h.Step(1)
+	alice.Expect("[bob] hello there")
+
+	bob.Send("ready")
+	alice.Send("start")
+	h.Step(1)
+	bob.Expect("The game begins in 3...")
+
+	h.StepFor(time.Second)
+	bob.Expect("The game begins in 2...")
+	if h.game.frame != 0 {
+		t.Fatalf("game advanced to frame %d during its countdown", h.game.frame)
+	}
+
+	h.StepFor(2 * time.Second)
+	alice.Expect("The game has begun!")
+	bob.Expect("The game has begun!")
+	if !h.game.started {
+		t.Fatalf("game didn't begin when the countdown ran out")
+	}
+	if alice.conn.Location() == nil || alice.conn.Location() == bob.conn.Location() {
+		t.Fatalf("expected alice and bob to start on different systems, got %v and %v", alice.conn.Location(), bob.conn.Location())
+	}
+
+	h.Step(1)
+	if h.game.frame != 1 {
+		t.Fatalf("expected the game to be on its first frame, got %d", h.game.frame)
+	}
+}
+
+func TestStagingCountdownCancelled(t *testing.T) {
+	h := newStagingHarness(t)
+	h.game.rules.StartCountdown = duration(3 * time.Second)
+	alice := h.Stage("alice")
+	bob := h.Stage("bob")
+
+	bob.Send("ready")
+	alice.Send("start")
+	h.Step(1)
+	bob.Send("ready")
+	h.Step(1)
+	alice.Expect("The countdown has been cancelled: bob is no longer ready.")
+
+	h.StepFor(5 * time.Second)
+	if h.game.started {
+		t.Fatalf("game began after its countdown was cancelled")
+	}
+}
+
+func TestStagingHostLeaves(t *testing.T) {
+	h := newStagingHarness(t)
+	alice := h.Stage("alice")
+	bob := h.Stage("bob")
+	if h.game.host != "alice" {
+		t.Fatalf("expected alice to host the game, got %q", h.game.host)
+	}
+
+	h.game.Submit(quitMessage{conn: alice.conn, link: alice.conn.link})
+	h.Step(1)
+	bob.Expect("alice has left; bob is now the host.")
+	if h.game.seatOf("alice") != nil {
+		t.Fatalf("alice kept her seat in a game that hadn't begun")
+	}
+
+	bob.Send("start")
+	h.Step(1)
+	bob.Expect("The game has begun!")
+}
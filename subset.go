@@ -0,0 +1,82 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// subset picks the part of a catalog that a game is played over. Without a
+// galaxy_size or radius in the rules, that's the whole catalog. Otherwise it's
+// the systems around a center: the galaxy_size systems nearest it, those no
+// more than radius parsecs from it, or, given both, the nearest galaxy_size
+// systems of those within the radius. The center is the system named or
+// numbered by the rules, the heart of the densest cluster in the catalog if
+// the rules say "cluster", or a random system if they don't say. The systems
+// picked are given in order of id.
+func subset(systems []*System, rng *rand.Rand, rules Rules) []*System {
+	if len(systems) == 0 || rules.Radius == 0 && (rules.GalaxySize == 0 || rules.GalaxySize >= len(systems)) {
+		return systems
+	}
+	tree := newKDTree(systems)
+
+	var center *System
+	switch rules.Center {
+	case "":
+		center = systems[rng.Intn(len(systems))]
+	case "cluster":
+		center = densest(systems, tree, rules)
+	default:
+		var err error
+		if center, err = pickSystem(systems, rules.Center); err != nil {
+			log_error("unable to center the galaxy, picking a system at random instead: %v", err)
+			center = systems[rng.Intn(len(systems))]
+		}
+	}
+
+	byID := make(map[int]*System, len(systems))
+	for _, s := range systems {
+		byID[s.id] = s
+	}
+	picked := []*System{center}
+	for it := tree.near(center); rules.GalaxySize == 0 || len(picked) < rules.GalaxySize; it.pop() {
+		n, ok := it.peek()
+		if !ok || rules.Radius > 0 && n.distance > rules.Radius {
+			break
+		}
+		picked = append(picked, byID[n.id])
+	}
+	sort.Slice(picked, func(i, j int) bool { return picked[i].id < picked[j].id })
+	return picked
+}
+
+// densest finds the system at the heart of the tightest cluster: the one with
+// the most systems within the rules' radius, or, if they don't give one, the
+// one whose galaxy_size nearest systems are the least spread out. Ties go to
+// the system with the lowest id.
+func densest(systems []*System, tree *kdTree, rules Rules) *System {
+	var best *System
+	bestScore := math.Inf(-1)
+	for _, sys := range systems {
+		var score float64
+		if rules.Radius > 0 {
+			tree.eachWithin(sys, rules.Radius, func(*System, float64) { score++ })
+		} else {
+			// the spread of a cluster is the distance to the farthest of it
+			it, reach := tree.near(sys), 0.0
+			for i := 1; i < rules.GalaxySize; i++ {
+				n, ok := it.peek()
+				if !ok {
+					break
+				}
+				reach = n.distance
+				it.pop()
+			}
+			score = -reach
+		}
+		if score > bestScore || score == bestScore && sys.id < best.id {
+			best, bestScore = sys, score
+		}
+	}
+	return best
+}
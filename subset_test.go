@@ -0,0 +1,113 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// subsetNames gives the names of the systems a galaxy is cut down to.
+func subsetNames(systems []*System, rules Rules) map[string]bool {
+	names := make(map[string]bool)
+	for _, sys := range subset(systems, rand.New(rand.NewSource(1)), rules) {
+		names[sys.name] = true
+	}
+	return names
+}
+
+func TestSubsetAroundCenter(t *testing.T) {
+	rules := defaultRules()
+	rules.GalaxySize, rules.Center = 2, "Delta"
+	names := subsetNames(defaultTestGalaxy(), rules)
+	if len(names) != 2 || !names["Delta"] || !names["Gamma"] {
+		t.Fatalf("expected Delta and its nearest neighbor, got %v", names)
+	}
+
+	rules = defaultRules()
+	rules.Radius, rules.Center = 1.5, "2"
+	names = subsetNames(defaultTestGalaxy(), rules)
+	if len(names) != 3 || !names["Alpha"] || !names["Beta"] || !names["Gamma"] {
+		t.Fatalf("expected the systems within 1.5 parsecs of Beta, got %v", names)
+	}
+
+	rules.GalaxySize = 2
+	if names = subsetNames(defaultTestGalaxy(), rules); len(names) != 2 || !names["Beta"] {
+		t.Fatalf("expected the 2 systems nearest Beta within the radius, got %v", names)
+	}
+}
+
+func TestSubsetFindsCluster(t *testing.T) {
+	var systems []*System
+	// a loose line of systems ten parsecs apart, and a tight knot of them
+	// some way off
+	for i := 0; i < 20; i++ {
+		systems = append(systems, testSystem(i+1, "", float64(i*10), 0, 0))
+	}
+	for i := 0; i < 5; i++ {
+		systems = append(systems, testSystem(21+i, "", 500+float64(i), 500, 0))
+	}
+
+	for _, rules := range []Rules{
+		{Center: "cluster", GalaxySize: 5},
+		{Center: "cluster", Radius: 5},
+	} {
+		picked := subset(systems, rand.New(rand.NewSource(1)), rules)
+		if len(picked) != 5 {
+			t.Fatalf("expected the 5 systems of the cluster, got %d", len(picked))
+		}
+		for _, sys := range picked {
+			if sys.id <= 20 {
+				t.Fatalf("expected only systems in the cluster, got %v", sys)
+			}
+		}
+	}
+}
+
+func TestSubsetGalaxy(t *testing.T) {
+	rules := defaultRules()
+	rules.GalaxySize, rules.Center = 3, "Alpha"
+	g := newGalaxy(defaultTestGalaxy(), rand.New(rand.NewSource(1)), rules)
+	if g.GetSystemByName("Delta") != nil {
+		t.Fatalf("a system outside of the subset is in the galaxy")
+	}
+	alpha := g.GetSystemByName("Alpha")
+	if n := g.Nearest(alpha, 10); len(n) != 2 {
+		t.Fatalf("expected Alpha to have 2 neighbors in the subset, got %v", n)
+	}
+	for seed := int64(0); seed < 10; seed++ {
+		for _, sys := range g.planSpawns(rand.New(rand.NewSource(seed)), 3, 0, nil) {
+			if g.GetSystemByID(sys.id) != sys {
+				t.Fatalf("spawned on %v, which isn't in the subset", sys)
+			}
+		}
+	}
+}
+
+func TestSubsetOptions(t *testing.T) {
+	s, err := parseGameSettings([]string{"size=10", "radius=50", "center=Kepler-22"})
+	if err != nil {
+		t.Fatalf("unable to parse subset options: %v", err)
+	}
+	if s.rules.GalaxySize != 10 || s.rules.Radius != 50 || s.rules.Center != "Kepler-22" {
+		t.Fatalf("subset options were parsed wrong: %+v", s.rules)
+	}
+
+	// the center is found the same way as any other system the player names
+	s, err = parseGameSettings(parseLine(`size=10 center="hd 11353"`))
+	if err != nil {
+		t.Fatalf("unable to parse a partial center: %v", err)
+	}
+	if s.rules.Center != "HD 113538" {
+		t.Fatalf("expected the galaxy to be centered on HD 113538, got %q", s.rules.Center)
+	}
+
+	for _, args := range [][]string{
+		{"size=10", "center=Nowhere"},
+		{"size=10", "center=kepler-2"},
+		{"center=cluster"},
+		{"radius=-1"},
+	} {
+		if _, err := parseGameSettings(args); err == nil {
+			t.Errorf("expected %v to be rejected", args)
+		}
+	}
+}
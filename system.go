@@ -47,11 +47,11 @@ func (s *System) Arrive(conn *Connection) {
 		s.players = make(map[*Connection]bool, 8)
 	}
 	s.players[conn] = true
-	if s.planets == 1 {
-		conn.Printf("you are in the system %v. There is %d planet here.\n", s, s.planets)
-	} else {
-		conn.Printf("you are in the system %v. There are %d planets here.\n", s, s.planets)
+	if conn.game != nil {
+		conn.intel.recordScan(newScanResult(s), conn.game.frame)
+		conn.game.Publish(s, arrivalEvent{player: conn.Name()})
 	}
+	conn.Emit(locationEvent{System: *s.ref(), Planets: s.planets})
 }
 
 func (s *System) Leave(p *Connection) {
@@ -83,10 +83,10 @@ func (s *System) NumInhabitants() int {
 func (e System) Store(db *sql.DB) {
 	_, err := db.Exec(`
     insert into planets
-    (name, x, y, z, planets)
+    (id, name, x, y, z, planets)
     values
-    (?, ?, ?, ?, ?)
-    ;`, e.name, e.x, e.y, e.z, e.planets)
+    (?, ?, ?, ?, ?, ?)
+    ;`, e.id, e.name, e.x, e.y, e.z, e.planets)
 	if err != nil {
 		log_error("unable to store system: %v", err)
 	}
@@ -96,10 +96,6 @@ func (s *System) DistanceTo(other *System) float64 {
 	return dist3d(s.x, s.y, s.z, other.x, other.y, other.z)
 }
 
-func (s *System) LightTimeTo(other *System) time.Duration {
-	return time.Duration(int64(s.DistanceTo(other) * 100000000))
-}
-
 func (s *System) BombTimeTo(other *System) time.Duration {
 	return time.Duration(int64(s.DistanceTo(other) * 110000000))
 }
@@ -128,29 +124,25 @@ func (s *System) Bombed(bomber *Connection, game *Game) {
 	s.EachConn(func(conn *Connection) {
 		conn.Die(game.frame)
 		s.Leave(conn)
-		bomber.MadeKill(conn)
+		if bomber != nil {
+			bomber.MadeKill(conn)
+		}
 	})
 	if s.colonizedBy != nil {
 		s.colonizedBy.Printf("your mining colony on %s has been destroyed!\n", s.name)
 		s.colonizedBy = nil
 	}
 
-	for id, other := range game.galaxy.systems {
-		if id == s.id {
-			continue
-		}
-		delay := s.LightTimeTo(game.galaxy.systems[id])
-		from := s
-		to := other
-		time.AfterFunc(delay, func() {
-			bombNotice(to, from)
-		})
-	}
+	game.Publish(s, bombingEvent{})
 }
 
 func bombNotice(to, from *System) {
 	to.EachConn(func(conn *Connection) {
-		conn.Printf("a bombing has been observed on %s\n", from.name)
+		conn.Emit(observationEvent{
+			Observed: "bombing",
+			System:   *from.ref(),
+			Message:  fmt.Sprintf("a bombing has been observed on %s", from.name),
+		})
 	})
 }
 
@@ -160,9 +152,27 @@ func (s System) String() string {
 
 type Neighborhood []Neighbor
 
-func (n Neighborhood) Len() int           { return len(n) }
-func (n Neighborhood) Less(i, j int) bool { return n[i].distance < n[j].distance }
-func (n Neighborhood) Swap(i, j int)      { n[i], n[j] = n[j], n[i] }
+func (n Neighborhood) Len() int      { return len(n) }
+func (n Neighborhood) Swap(i, j int) { n[i], n[j] = n[j], n[i] }
+
+// Less orders neighbors by distance, breaking ties by id so that the order of
+// a neighborhood is always the same.
+func (n Neighborhood) Less(i, j int) bool {
+	if n[i].distance == n[j].distance {
+		return n[i].id < n[j].id
+	}
+	return n[i].distance < n[j].distance
+}
+
+func (n *Neighborhood) peek() (Neighbor, bool) {
+	if len(*n) == 0 {
+		return Neighbor{}, false
+	}
+	return (*n)[0], true
+}
+
+func (n *Neighborhood) pop()               { *n = (*n)[1:] }
+func (n *Neighborhood) rest() Neighborhood { return append(Neighborhood{}, *n...) }
 
 type Neighbor struct {
 	id       int
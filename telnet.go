@@ -0,0 +1,313 @@
+package main
+
+import (
+	"net"
+	"sync"
+	"unicode/utf8"
+)
+
+// telnet commands and options, from RFC 854 and friends.
+const (
+	telnetSE   = 240
+	telnetSB   = 250
+	telnetWILL = 251
+	telnetWONT = 252
+	telnetDO   = 253
+	telnetDONT = 254
+	telnetIAC  = 255
+
+	telnetOptEcho  = 1
+	telnetOptSGA   = 3
+	telnetOptTType = 24
+	telnetOptNAWS  = 31
+
+	telnetTTypeIs   = 0
+	telnetTTypeSend = 1
+)
+
+// states of the telnet input parser
+const (
+	telnetData = iota
+	telnetCommand
+	telnetOption
+	telnetSub
+	telnetSubCommand
+)
+
+// maxSubnegotiation caps the size of a telnet subnegotiation, so that a client
+// can't make us buffer an endless one.
+const maxSubnegotiation = 64
+
+// telnetConn is the telnet layer under a player's raw TCP socket. It strips
+// telnet commands and control bytes from the player's input and handles line
+// editing, so that only whole, clean lines reach the Connection.
+//
+// No telnet options are negotiated until start is called, since bots speaking
+// the JSON protocol over the same port don't expect them. Once started, the
+// server offers to suppress go-ahead and asks for the client's window size
+// (NAWS) and terminal type (TTYPE), and output is translated to the network
+// virtual terminal's line endings.
+type telnetConn struct {
+	net.Conn
+
+	// input parser state, touched only by the goroutine reading the socket
+	state   int
+	verb    byte
+	sub     []byte
+	cr      bool
+	line    []byte
+	pending []byte
+	raw     []byte
+
+	mu        sync.Mutex // guards everything below
+	active    bool
+	echoing   bool // whether we've told the client that we'll do the echoing
+	requested map[byte]bool
+	enabled   map[byte]bool
+	cols      int
+	ttype     string
+}
+
+func newTelnetConn(conn net.Conn) *telnetConn {
+	return &telnetConn{
+		Conn:      conn,
+		raw:       make([]byte, 512),
+		requested: make(map[byte]bool),
+		enabled:   make(map[byte]bool),
+	}
+}
+
+// start begins negotiating telnet options with the client.
+func (t *telnetConn) start() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.active = true
+	t.request(telnetWILL, telnetOptSGA)
+	t.request(telnetDO, telnetOptNAWS)
+	t.request(telnetDO, telnetOptTType)
+}
+
+// width is the client's terminal width, or 0 if the client hasn't said.
+func (t *telnetConn) width() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.cols
+}
+
+// terminalType is the terminal type reported by the client, if any.
+func (t *telnetConn) terminalType() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.ttype
+}
+
+// setEcho turns the client's local echo on or off. To turn it off, the server
+// offers to do the echoing itself, and then doesn't.
+func (t *telnetConn) setEcho(on bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.active || t.echoing == !on {
+		return
+	}
+	t.echoing = !on
+	if on {
+		t.send(telnetIAC, telnetWONT, telnetOptEcho)
+		// the client didn't echo the end of the hidden line either
+		t.send('\r', '\n')
+	} else {
+		t.send(telnetIAC, telnetWILL, telnetOptEcho)
+	}
+}
+
+// Read reads whole lines of input from the client.
+func (t *telnetConn) Read(b []byte) (int, error) {
+	for len(t.pending) == 0 {
+		n, err := t.Conn.Read(t.raw)
+		t.parse(t.raw[:n])
+		if err != nil && len(t.pending) == 0 {
+			return 0, err
+		}
+	}
+	n := copy(b, t.pending)
+	t.pending = t.pending[n:]
+	return n, nil
+}
+
+// Write writes output to the client, translating line endings and escaping
+// IAC bytes once telnet has been started.
+func (t *telnetConn) Write(b []byte) (int, error) {
+	t.mu.Lock()
+	active := t.active
+	t.mu.Unlock()
+	if !active {
+		return t.Conn.Write(b)
+	}
+	out := make([]byte, 0, len(b)+len(b)/8)
+	for i, c := range b {
+		switch {
+		case c == '\n' && (i == 0 || b[i-1] != '\r'):
+			out = append(out, '\r', '\n')
+		case c == telnetIAC:
+			out = append(out, telnetIAC, telnetIAC)
+		default:
+			out = append(out, c)
+		}
+	}
+	if _, err := t.Conn.Write(out); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (t *telnetConn) parse(data []byte) {
+	for _, c := range data {
+		switch t.state {
+		case telnetData:
+			t.data(c)
+		case telnetCommand:
+			t.state = telnetData
+			switch c {
+			case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+				t.verb = c
+				t.state = telnetOption
+			case telnetSB:
+				t.sub = t.sub[:0]
+				t.state = telnetSub
+			}
+		case telnetOption:
+			t.option(t.verb, c)
+			t.state = telnetData
+		case telnetSub:
+			if c == telnetIAC {
+				t.state = telnetSubCommand
+			} else if len(t.sub) < maxSubnegotiation {
+				t.sub = append(t.sub, c)
+			}
+		case telnetSubCommand:
+			switch c {
+			case telnetSE:
+				t.subnegotiation(t.sub)
+				t.state = telnetData
+			case telnetIAC:
+				if len(t.sub) < maxSubnegotiation {
+					t.sub = append(t.sub, c)
+				}
+				t.state = telnetSub
+			default:
+				t.state = telnetData
+			}
+		}
+	}
+}
+
+// data handles a byte of the client's input that isn't part of a telnet
+// command. Clients end lines with any of CR LF, CR NUL, a bare CR or a bare
+// LF.
+func (t *telnetConn) data(c byte) {
+	cr := t.cr
+	t.cr = false
+	switch {
+	case c == telnetIAC:
+		t.state = telnetCommand
+		t.cr = cr
+	case c == '\r':
+		t.endLine()
+		t.cr = true
+	case c == '\n':
+		if !cr {
+			t.endLine()
+		}
+	case c == '\b' || c == 0x7f:
+		if _, size := utf8.DecodeLastRune(t.line); size > 0 {
+			t.line = t.line[:len(t.line)-size]
+		}
+	case c < ' ' && c != '\t':
+		// control characters, including the NUL after a CR
+	default:
+		t.line = append(t.line, c)
+	}
+}
+
+func (t *telnetConn) endLine() {
+	t.pending = append(t.pending, t.line...)
+	t.pending = append(t.pending, '\n')
+	t.line = t.line[:0]
+}
+
+// option handles a client's WILL, WONT, DO or DONT for a telnet option. A
+// request is only answered if it would change the option's state, so that the
+// two ends can't get stuck acknowledging each other forever.
+func (t *telnetConn) option(verb, opt byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch verb {
+	case telnetWILL:
+		if opt != telnetOptNAWS && opt != telnetOptTType {
+			t.send(telnetIAC, telnetDONT, opt)
+			return
+		}
+		if t.enabled[opt] {
+			return
+		}
+		t.enabled[opt] = true
+		if !t.requested[opt] {
+			t.send(telnetIAC, telnetDO, opt)
+		}
+		if opt == telnetOptTType {
+			t.send(telnetIAC, telnetSB, telnetOptTType, telnetTTypeSend, telnetIAC, telnetSE)
+		}
+	case telnetWONT:
+		t.enabled[opt] = false
+	case telnetDO:
+		switch opt {
+		case telnetOptSGA:
+			if !t.requested[opt] {
+				t.send(telnetIAC, telnetWILL, opt)
+			}
+		case telnetOptEcho:
+			if !t.echoing {
+				t.send(telnetIAC, telnetWONT, opt)
+			}
+		default:
+			t.send(telnetIAC, telnetWONT, opt)
+		}
+	case telnetDONT:
+		if opt == telnetOptEcho {
+			t.echoing = false
+		}
+	}
+}
+
+func (t *telnetConn) subnegotiation(sub []byte) {
+	if len(sub) == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch sub[0] {
+	case telnetOptNAWS:
+		if len(sub) >= 5 {
+			t.cols = int(sub[1])<<8 | int(sub[2])
+		}
+	case telnetOptTType:
+		if len(sub) >= 2 && sub[1] == telnetTTypeIs {
+			t.ttype = string(sub[2:])
+			log_info("telnet client %v has terminal type %s", t.RemoteAddr(), t.ttype)
+		}
+	}
+}
+
+// request asks the client to enable an option. Callers must hold t.mu.
+func (t *telnetConn) request(verb, opt byte) {
+	t.requested[opt] = true
+	t.send(telnetIAC, verb, opt)
+}
+
+// send writes raw telnet commands to the client.
+func (t *telnetConn) send(b ...byte) {
+	if _, err := t.Conn.Write(b); err != nil {
+		log_error("unable to send telnet command to %v: %v", t.RemoteAddr(), err)
+	}
+}
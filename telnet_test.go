@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestTelnetInput(t *testing.T) {
+	server, sock := net.Pipe()
+	defer sock.Close()
+	go io.Copy(ioutil.Discard, sock)
+	tc := newTelnetConn(server)
+
+	go func() {
+		sock.Write([]byte("lo\xff\xfb\x1fok"))                     // WILL NAWS in the middle of a line
+		sock.Write([]byte("\xff\xfa\x1f\x00\x64\x00\x18\xff\xf0")) // NAWS: 100x24
+		sock.Write([]byte(" ab\x7fc\r\x00"))                       // backspace, CR NUL
+		sock.Write([]byte("hel\x07lo\r\n"))                        // bell, CR LF
+		sock.Write([]byte("x\n"))                                  // bare LF
+	}()
+
+	r := bufio.NewReader(tc)
+	for _, want := range []string{"look ac\n", "hello\n", "x\n"} {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("unable to read line: %v", err)
+		}
+		if line != want {
+			t.Errorf("read %q, expected %q", line, want)
+		}
+	}
+	if w := tc.width(); w != 100 {
+		t.Errorf("width is %d, expected 100", w)
+	}
+}
+
+func TestTelnetNegotiation(t *testing.T) {
+	name := uniqueName("telly")
+	cl := newClient(t, name, func(sock net.Conn) *Connection {
+		go handleConnection(newTelnetConn(sock))
+		return nil
+	})
+	cl.Expect("\xff\xfd\x1f") // DO NAWS
+	cl.Expect("\xff\xfd\x18") // DO TTYPE
+	cl.Expect("What is your name, adventurer?\r\n")
+
+	cl.Write("\xff\xfb\x18")                  // WILL TTYPE
+	cl.Expect("\xff\xfa\x18\x01\xff\xf0")     // SB TTYPE SEND
+	cl.Write("\xff\xfa\x18\x00xterm\xff\xf0") // SB TTYPE IS xterm
+	cl.Write("\xff\xfb\x1f\xff\xfa\x1f\x00\x64\x00\x18\xff\xf0" + name + "\r\n")
+	cl.Expect("Choose a password:")
+	cl.Expect("\xff\xfb\x01") // WILL ECHO, hiding the password
+	cl.Write("hunter2\r\x00")
+	cl.Write("hunter2\r\x00")
+	cl.Expect("\xff\xfc\x01") // WONT ECHO
+	cl.Expect("Available Commands in state: Lobby")
+	cl.Expect(strings.Repeat("-", 100) + "\r\n")
+
+	// passwords asked for by account commands are hidden too
+	cl.Reset()
+	cl.Write("delete\r\n")
+	cl.Expect("Password:")
+	cl.Expect("\xff\xfb\x01") // WILL ECHO
+	cl.Write("wrong\r\n")
+	cl.Expect("\xff\xfc\x01") // WONT ECHO
+	cl.Expect("wrong password")
+}
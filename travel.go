@@ -9,14 +9,18 @@ import (
 
 type TravelState struct {
 	CommandSuite
+	rules     *Rules
 	start     *System
 	dest      *System
 	travelled float64 // distance traveled so far in parsecs
 	dist      float64 // distance between start and end in parsecs
 }
 
-func NewTravel(c *Connection, start, dest *System) ConnectionState {
+// newTravelState creates the state of a ship on its way from start to dest,
+// moving at the speed given by the rules.
+func newTravelState(rules *Rules, start, dest *System) *TravelState {
 	t := &TravelState{
+		rules: rules,
 		start: start,
 		dest:  dest,
 		dist:  start.DistanceTo(dest),
@@ -24,6 +28,7 @@ func NewTravel(c *Connection, start, dest *System) ConnectionState {
 	t.CommandSuite = CommandSet{
 		playersCommand,
 		balCommand,
+		intelCommand,
 		Command{
 			name:    "progress",
 			summary: "displays how far you are along your travel",
@@ -59,10 +64,11 @@ func (t *TravelState) Enter(c *Connection) {
 		t.tripTime(),
 	})
 	t.start.Leave(c)
+	c.game.Publish(t.start, departureEvent{player: c.Name()})
 }
 
 func (t *TravelState) Tick(c *Connection, frame int64) ConnectionState {
-	dt := options.playerSpeed * options.lightSpeed
+	dt := t.rules.PlayerSpeed * t.rules.LightSpeed
 
 	segmentLength := t.dist / 18
 	x := t.travelled
@@ -117,8 +123,8 @@ func (t *TravelState) progress(c *Connection, args ...string) {
 
 func (t *TravelState) remaining() time.Duration {
 	remaining := t.dist - t.travelled
-	frames := remaining / (options.playerSpeed * options.lightSpeed)
-	return framesToDur(int64(frames))
+	frames := remaining / (t.rules.PlayerSpeed * t.rules.LightSpeed)
+	return t.rules.duration(int64(frames))
 }
 
 func (t *TravelState) eta() time.Time {
@@ -127,6 +133,5 @@ func (t *TravelState) eta() time.Time {
 }
 
 func (t *TravelState) tripTime() time.Duration {
-	frames := t.dist / (options.playerSpeed * options.lightSpeed)
-	return framesToDur(int64(frames))
+	return t.rules.tripTime(t.dist)
 }
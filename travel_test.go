@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestTravelTiming(t *testing.T) {
+	h := newHarness(t)
+	alice := h.Join("alice", 1)
+
+	alice.Send("goto 2")
+	h.Step(1)
+	if _, ok := alice.conn.ConnectionState.(*TravelState); !ok {
+		t.Fatalf("expected alice to be travelling, she is %v", alice.conn.ConnectionState)
+	}
+	if h.System(1).players[alice.conn] {
+		t.Fatalf("alice is still on her starting system")
+	}
+
+	// Alpha and Beta are one parsec apart.
+	frames := int(1 / (h.game.rules.PlayerSpeed * h.game.rules.LightSpeed))
+	h.Step(frames - 5)
+	if _, ok := alice.conn.ConnectionState.(*TravelState); !ok {
+		t.Fatalf("alice arrived early: %v after %d frames", alice.conn.ConnectionState, frames-4)
+	}
+
+	h.Step(5)
+	if alice.conn.Location() != h.System(2) {
+		t.Fatalf("expected alice to have arrived at Beta, she is %v", alice.conn.ConnectionState)
+	}
+	if !h.System(2).players[alice.conn] {
+		t.Fatalf("Beta doesn't know that alice is there")
+	}
+	alice.Expect("You have arrived at Beta")
+}
+
+func TestTravelToUnknownSystem(t *testing.T) {
+	h := newHarness(t)
+	alice := h.Join("alice", 1)
+
+	alice.Send("goto 99")
+	h.Step(1)
+	alice.Expect("no such system: 99")
+	if alice.conn.Location() != h.System(1) {
+		t.Fatalf("alice should not have gone anywhere, she is %v", alice.conn.ConnectionState)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	// browser clients are served from anywhere; there's nothing behind the
+	// websocket that a cross-origin page could abuse that a telnet user
+	// couldn't do directly.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// wsConn adapts a websocket to the net.Conn interface, so that browser
+// players are handled by the same Connection type as telnet players. Every
+// message received from the browser is treated as a line of input, and every
+// write is sent to the browser as a single text message.
+type wsConn struct {
+	*websocket.Conn
+	protocol protocol // requested in the websocket handshake
+	r        io.Reader
+}
+
+func (c *wsConn) handshakeProtocol() protocol { return c.protocol }
+
+func (c *wsConn) Read(b []byte) (int, error) {
+	for c.r == nil {
+		_, msg, err := c.ReadMessage()
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				return 0, io.EOF
+			}
+			return 0, err
+		}
+		if !bytes.HasSuffix(msg, []byte("\n")) {
+			msg = append(msg, '\n')
+		}
+		c.r = bytes.NewReader(msg)
+	}
+	n, err := c.r.Read(b)
+	if err == io.EOF {
+		c.r = nil
+		err = nil
+	}
+	return n, err
+}
+
+func (c *wsConn) Write(b []byte) (int, error) {
+	if err := c.WriteMessage(websocket.TextMessage, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *wsConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+
+// serveWebsocket upgrades an http request to a websocket and plays the game
+// over it. The client picks its protocol with the protocol query parameter,
+// e.g. /ws?protocol=json; the default is the text protocol.
+func serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log_error("unable to upgrade websocket connection: %v", err)
+		return
+	}
+	conn := &wsConn{Conn: ws}
+	if r.URL.Query().Get("protocol") == "json" {
+		conn.protocol = jsonProtocol
+	}
+	log_info("websocket connection from %v", ws.RemoteAddr())
+	handleConnection(conn)
+}
+
+// listenWebsocket serves websocket clients on the given address.
+func listenWebsocket(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", serveWebsocket)
+	server := &http.Server{Addr: addr, Handler: mux}
+	addListener(server)
+	log_info("listening for websockets on %s/ws", addr)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log_error("websocket listener stopped: %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialWebsocket starts a websocket server and connects to it, returning the
+// messages sent by the server on a channel.
+func dialWebsocket(t *testing.T, query string) (*websocket.Conn, <-chan string) {
+	srv := httptest.NewServer(http.HandlerFunc(serveWebsocket))
+	t.Cleanup(srv.Close)
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws" + query
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("unable to dial websocket: %v", err)
+	}
+	t.Cleanup(func() { ws.Close() })
+
+	messages := make(chan string, 256)
+	go func() {
+		defer close(messages)
+		for {
+			_, msg, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			messages <- string(msg)
+		}
+	}()
+	return ws, messages
+}
+
+// expectMessage waits for a websocket message containing text.
+func expectMessage(t *testing.T, messages <-chan string, text string) {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				t.Fatalf("websocket closed while waiting for %q", text)
+			}
+			if strings.Contains(msg, text) {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %q", text)
+		}
+	}
+}
+
+func TestWebsocketText(t *testing.T) {
+	name := uniqueName("browser")
+	ws, messages := dialWebsocket(t, "")
+	expectMessage(t, messages, "A game of dark cunning")
+	expectMessage(t, messages, "What is your name, adventurer?")
+
+	ws.WriteMessage(websocket.TextMessage, []byte(name))
+	expectMessage(t, messages, "Choose a password:")
+	ws.WriteMessage(websocket.TextMessage, []byte("hunter2"))
+	ws.WriteMessage(websocket.TextMessage, []byte("hunter2"))
+	expectMessage(t, messages, "Available Commands in state: Lobby")
+}
+
+func TestWebsocketJSON(t *testing.T) {
+	name := uniqueName("webbot")
+	ws, messages := dialWebsocket(t, "?protocol=json")
+	expectMessage(t, messages, `{"type":"hello","protocol":"json","version":1}`)
+	expectMessage(t, messages, `{"type":"state","state":"Lobby"}`)
+	expectMessage(t, messages, `{"type":"prompt","prompt":"name"`)
+
+	ws.WriteMessage(websocket.TextMessage, []byte(`{"line": "`+name+`"}`))
+	ws.WriteMessage(websocket.TextMessage, []byte(`{"line": "hunter2"}`))
+	ws.WriteMessage(websocket.TextMessage, []byte(`{"line": "hunter2"}`))
+	expectMessage(t, messages, `you look new around these parts`)
+
+	ws.WriteMessage(websocket.TextMessage, []byte(`{"command": "new"}`))
+	ws.WriteMessage(websocket.TextMessage, []byte(`{"command": "start"}`))
+	expectMessage(t, messages, `{"type":"location","system":{"id":`)
+}